@@ -10,7 +10,7 @@ export default function () {
     let url = `${base_path}/sales`
 
     let res = http.post(url, JSON.stringify(data), {
-        headers: { 'Content-Type': 'application/json' },
+        headers: { 'Content-Type': 'application/json', 'X-Api-Key': `${__ENV.API_KEY}` },
       });
 
       console.log(res.body)
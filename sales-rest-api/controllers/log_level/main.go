@@ -0,0 +1,58 @@
+package log_level
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msfidelis/sales-rest-api/pkg/log"
+)
+
+type Request struct {
+	Level string `json:"level" binding:"required"`
+}
+
+type Response struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// Get godoc
+// @Summary Return the current log level
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} Response
+// @Router /admin/log-level [get]
+func Get(c *gin.Context) {
+	c.JSON(http.StatusOK, Response{Level: log.GetLevel()})
+}
+
+// Update godoc
+// @Summary Change the log level at runtime
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} Response
+// @Router /admin/log-level [put]
+func Update(c *gin.Context) {
+	var request Request
+
+	logger := log.FromContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous := log.GetLevel()
+
+	if err := log.SetLevel(request.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Warn().
+		Str("Action", "log-level").
+		Str("Previous", previous).
+		Str("Level", log.GetLevel()).
+		Msg("Log level changed at runtime")
+
+	c.JSON(http.StatusOK, Response{Level: log.GetLevel()})
+}
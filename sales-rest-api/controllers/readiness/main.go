@@ -2,14 +2,29 @@ package readiness
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/msfidelis/sales-rest-api/pkg/log"
 	"github.com/msfidelis/sales-rest-api/pkg/memory_cache"
+	"github.com/msfidelis/sales-rest-api/pkg/resilience"
 )
 
 type Response struct {
-	Status string `json:"status" binding:"required"`
+	Status       string            `json:"status" binding:"required"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+var (
+	mutex  sync.RWMutex
+	checks = make(map[string]func() bool)
+)
+
+// AddCheck - Registers a dependency that must be ready for the API to receive traffic
+func AddCheck(name string, check func() bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	checks[name] = check
 }
 
 // Ok godoc
@@ -17,15 +32,36 @@ type Response struct {
 // @Tags readiness
 // @Produce json
 // @Success 200 {object} Response
+// @Failure 503 {object} Response
 // @Router /readiness [get]
 func Ok(c *gin.Context) {
 	m := memory_cache.GetInstance()
-	log := log.Instance()
+	log := log.FromContext(c.Request.Context())
 
 	var response Response
 	_, readiness_lock := m.Get("readiness.ok")
 
-	if readiness_lock {
+	// Circuit breaker states of the AWS dependencies
+	response.Dependencies = resilience.States()
+	not_ready := false
+	for _, state := range response.Dependencies {
+		if state == resilience.Open.String() {
+			not_ready = true
+		}
+	}
+
+	mutex.RLock()
+	for name, check := range checks {
+		if check() {
+			response.Dependencies[name] = "ready"
+		} else {
+			response.Dependencies[name] = "not_ready"
+			not_ready = true
+		}
+	}
+	mutex.RUnlock()
+
+	if readiness_lock || not_ready {
 		response.Status = "NotReady"
 		log.Warn().
 			Str("status", response.Status).
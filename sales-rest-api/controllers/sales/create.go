@@ -1,7 +1,7 @@
 package sales
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
 	"os"
 	"time"
@@ -12,11 +12,16 @@ import (
 	"github.com/gin-gonic/gin"
 	guuid "github.com/google/uuid"
 	"github.com/msfidelis/sales-rest-api/models/sales_model"
+	"github.com/msfidelis/sales-rest-api/pkg/codec"
+	"github.com/msfidelis/sales-rest-api/pkg/events"
 	"github.com/msfidelis/sales-rest-api/pkg/log"
 	"github.com/msfidelis/sales-rest-api/pkg/parameter_store"
-	"github.com/msfidelis/sales-rest-api/pkg/sns"
+	"github.com/msfidelis/sales-rest-api/pkg/publisher"
 )
 
+// publishTimeout - Bounds the publish of the event of a stored sale, retries included
+const publishTimeout = 10 * time.Second
+
 type Request struct {
 	Product string  `json:"product" binding:"required"`
 	Amount  float64 `json:"amount" binding:"required"`
@@ -39,30 +44,25 @@ func Create(c *gin.Context) {
 	var request Request
 	var response Response
 
-	log := log.Instance()
+	ctx := c.Request.Context()
+	log := log.FromContext(ctx)
 
-	sns_processing_topic := os.Getenv("SNS_SALES_PROCESSING_TOPIC")
-	ssm_site_state_parameter := os.Getenv("SSM_PARAMETER_STORE_STATE")
 	aws_region := os.Getenv("AWS_REGION")
 
-	site_state, err := parameter_store.GetParamValue(ssm_site_state_parameter, 30)
+	site_state, err := parameter_store.GetSiteStateWithContext(ctx, 30)
 
 	if err != nil {
 		log.Error().
 			Str("Action", "create").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("Error", err.Error()).
 			Msg("Error to recover site state from parameter store")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(status(c, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		log.Error().
 			Str("Action", "create").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("Error", err.Error()).
 			Msg("Error to Bind JSON")
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -75,8 +75,6 @@ func Create(c *gin.Context) {
 	if err != nil {
 		log.Error().
 			Str("Action", "create").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("Error", err.Error()).
 			Msg("Error to create DynamoDB Session")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -95,15 +93,13 @@ func Create(c *gin.Context) {
 
 	dao := sales_model.NewModelDAO(svc)
 
-	err = dao.Create(saleModel)
+	err = dao.CreateWithContext(ctx, saleModel)
 	if err != nil {
 		log.Error().
 			Str("Action", "create").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("Error", err.Error()).
 			Msg("Error to save item to dynamoDB")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(status(c, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -114,48 +110,71 @@ func Create(c *gin.Context) {
 
 	log.Info().
 		Str("Action", "create").
-		Str("Region", aws_region).
-		Str("State", site_state).
 		Str("Id", response.Id).
 		Str("Product", response.Product).
 		Float64("Amount", response.Amount).
 		Msg("Sale persisted on DynamoDB")
 
-	json_string, err := json.Marshal(saleModel)
+	event, err := events.New(events.SaleCreated, time.Unix(saleModel.Timestamp, 0), saleModel)
 	if err != nil {
 		log.Error().
 			Str("Action", "create").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("Error", err.Error()).
-			Msg("Error to marshall model on JSON String")
+			Msg("Error to build sale event envelope")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err = sns.Publish(string(json_string), sns_processing_topic)
+	encoder := codec.GetInstance()
 
+	message, err := encoder.Encode(event)
 	if err != nil {
 		log.Error().
 			Str("Action", "create").
-			Str("Region", aws_region).
-			Str("State", site_state).
+			Str("ContentType", encoder.ContentType()).
 			Str("Error", err.Error()).
-			Str("SNS_Topic", sns_processing_topic).
-			Msg("Failed to publish message on SALES_PROCESSING topic")
+			Msg("Error to encode sale event")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	message.SetEventAttributes(codec.Attributes{
+		EventType:    event.Type,
+		Product:      saleModel.Product,
+		SourceRegion: event.SourceRegion,
+		SiteState:    site_state,
+	})
+
+	message.GroupId = saleModel.ID
+	message.DeduplicationId = codec.DeduplicationId(saleModel.ID, event.Type)
+
+	sale_publisher := publisher.GetInstance()
+
+	// The sale is already stored: a client disconnect or the route timeout must not cancel its
+	// event, so the publish runs detached from the request with its own deadline
+	publish_ctx, cancel := context.WithTimeout(detached{parent: ctx}, publishTimeout)
+	err = sale_publisher.Publish(publish_ctx, message)
+	cancel()
+
+	if err != nil {
+		log.Error().
+			Str("Action", "create").
+			Str("Error", err.Error()).
+			Str("Publisher", sale_publisher.String()).
+			Msg("Failed to publish sale processing event")
+		c.JSON(status(c, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
 	log.Info().
 		Str("Action", "create").
-		Str("Region", aws_region).
-		Str("State", site_state).
-		Str("SNS_Topic", sns_processing_topic).
+		Str("Publisher", sale_publisher.String()).
+		Str("EventId", event.EventID).
+		Str("ContentType", encoder.ContentType()).
 		Str("Id", response.Id).
 		Str("Product", response.Product).
 		Float64("Amount", response.Amount).
-		Msg("Sale processing event published on SNS Topic")
+		Msg("Sale processing event published")
 
 	c.JSON(http.StatusCreated, response)
 }
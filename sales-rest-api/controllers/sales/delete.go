@@ -32,9 +32,9 @@ func DeleteById(c *gin.Context) {
 	svc := dynamodb.New(sess)
 	dao := sales_model.NewModelDAO(svc)
 
-	err = dao.Delete(id)
+	err = dao.DeleteWithContext(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(status(c, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -23,21 +23,19 @@ func GetByID(c *gin.Context) {
 
 	var response Response
 
-	log := log.Instance()
+	ctx := c.Request.Context()
+	log := log.FromContext(ctx)
 
-	ssm_site_state_parameter := os.Getenv("SSM_PARAMETER_STORE_STATE")
 	aws_region := os.Getenv("AWS_REGION")
 
-	site_state, err := parameter_store.GetParamValue(ssm_site_state_parameter, 30)
+	_, err := parameter_store.GetSiteStateWithContext(ctx, 30)
 
 	if err != nil {
 		log.Error().
 			Str("Action", "read").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("Error", err.Error()).
 			Msg("Error to recover site state from parameter store")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(status(c, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -49,8 +47,6 @@ func GetByID(c *gin.Context) {
 	if err != nil {
 		log.Error().
 			Str("Action", "read").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("Error", err.Error()).
 			Msg("Error to read DynamoDB Session")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -60,23 +56,19 @@ func GetByID(c *gin.Context) {
 	svc := dynamodb.New(sess)
 	dao := sales_model.NewModelDAO(svc)
 
-	sale, err := dao.GetByID(id)
+	sale, err := dao.GetByIDWithContext(ctx, id)
 	if err != nil {
 		log.Error().
 			Str("Action", "read").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("Error", err.Error()).
 			Msg("Error to execute DynamoDB Query")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(status(c, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
 	if sale == nil {
 		log.Warn().
 			Str("Action", "read").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("Id", id).
 			Str("Error", err.Error()).
 			Msg("Item not found")
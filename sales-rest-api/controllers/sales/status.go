@@ -0,0 +1,28 @@
+package sales
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// status - Gateway Timeout when the route deadline expired during the call, fallback otherwise
+func status(c *gin.Context, fallback int) int {
+	if c.Request.Context().Err() == context.DeadlineExceeded {
+		return http.StatusGatewayTimeout
+	}
+	return fallback
+}
+
+// detached - Keeps the values of the request context, like its logger, without its cancellation
+// or deadline; side effects that must follow a committed write run on it
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (d detached) Done() <-chan struct{}             { return nil }
+func (d detached) Err() error                        { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
@@ -6,7 +6,8 @@ require (
 	github.com/Depado/ginprom v1.7.11
 	github.com/PuerkitoBio/purell v1.2.0 // indirect
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751
-	github.com/aws/aws-sdk-go v1.44.289 // indirect
+	github.com/alicebob/miniredis/v2 v2.30.4
+	github.com/aws/aws-sdk-go v1.44.289
 	github.com/coreos/go-systemd v0.0.0-20190321100706-95778dfbb74e // indirect
 	github.com/gin-contrib/logger v0.2.5
 	github.com/gin-gonic/gin v1.9.1
@@ -14,15 +15,17 @@ require (
 	github.com/go-openapi/spec v0.20.9 // indirect
 	github.com/go-openapi/swag v0.22.4 // indirect
 	github.com/go-playground/validator/v10 v10.14.1 // indirect
-	github.com/google/uuid v1.3.0 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/google/uuid v1.3.0
 	github.com/klauspost/cpuid/v2 v2.2.5 // indirect
 	github.com/kr/pty v1.1.5 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/msfidelis/gin-chaos-monkey v0.0.6
 	github.com/patrickmn/go-cache v2.1.0+incompatible
-	github.com/prometheus/client_golang v1.16.0 // indirect
+	github.com/prometheus/client_golang v1.16.0
 	github.com/prometheus/common v0.44.0 // indirect
 	github.com/prometheus/procfs v0.11.0 // indirect
+	github.com/redis/go-redis/v9 v9.0.5
 	github.com/rs/zerolog v1.29.1
 	github.com/satori/go.uuid v1.2.0 // indirect
 	github.com/swaggo/files v1.0.1
@@ -33,6 +36,7 @@ require (
 	github.com/zcalusic/sysinfo v0.0.0-20200228145645-a159d7cc708b
 	github.com/zenazn/goji v0.9.0 // indirect
 	golang.org/x/tools v0.10.0 // indirect
+	google.golang.org/protobuf v1.30.0
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 	gopkg.in/go-playground/validator.v8 v8.18.2 // indirect
 )
@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/msfidelis/sales-rest-api/controllers/healthcheck"
 	"github.com/msfidelis/sales-rest-api/controllers/liveness"
+	"github.com/msfidelis/sales-rest-api/controllers/log_level"
 	"github.com/msfidelis/sales-rest-api/controllers/readiness"
 	"github.com/msfidelis/sales-rest-api/controllers/sales"
 	"github.com/msfidelis/sales-rest-api/controllers/version"
@@ -10,7 +11,6 @@ import (
 
 	// "github.com/msfidelis/sales-rest-api/controllers/system"
 	"context"
-	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -18,12 +18,16 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/msfidelis/sales-rest-api/pkg/auth"
+	"github.com/msfidelis/sales-rest-api/pkg/codec"
+	"github.com/msfidelis/sales-rest-api/pkg/configuration"
 	loggerInternal "github.com/msfidelis/sales-rest-api/pkg/log"
+	"github.com/msfidelis/sales-rest-api/pkg/publisher"
+	"github.com/msfidelis/sales-rest-api/pkg/rate_limit"
+	"github.com/msfidelis/sales-rest-api/pkg/resilience"
 
 	"github.com/Depado/ginprom"
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 
 	// "github.com/patrickmn/go-cache"
 	"github.com/msfidelis/sales-rest-api/pkg/memory_cache"
@@ -52,18 +56,16 @@ func main() {
 
 	router := gin.New()
 
-	// Logger
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	if gin.IsDebugging() {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	}
+	configs := configuration.Load()
 
-	log.Logger = log.Output(
-		zerolog.ConsoleWriter{
-			Out:     os.Stderr,
-			NoColor: false,
-		},
-	)
+	// Logger
+	logInternal := loggerInternal.Setup(loggerInternal.Config{
+		Service: configs.Application,
+		Version: configs.Version,
+		Region:  os.Getenv("AWS_REGION"),
+		Level:   configs.LogLevel,
+		Format:  configs.LogFormat,
+	})
 
 	// Memory Cache Singleton
 	c := memory_cache.GetInstance()
@@ -75,7 +77,10 @@ func main() {
 	}
 	probe_time, err := strconv.ParseUint(probe_time_raw, 10, 64)
 	if err != nil {
-		fmt.Println("Environment variable READINESS_PROBE_MOCK_TIME_IN_SECONDS conversion error", err)
+		logInternal.
+			Error().
+			Str("Error", err.Error()).
+			Msg("Environment variable READINESS_PROBE_MOCK_TIME_IN_SECONDS conversion error")
 	}
 	c.Set("readiness.ok", "false", time.Duration(probe_time)*time.Second)
 
@@ -86,14 +91,78 @@ func main() {
 		ginprom.Path("/metrics"),
 	)
 
-	// Logger
-	logInternal := loggerInternal.Instance()
+	// Retries and Circuit Breakers around AWS dependencies
+	resilience.Setup(configs.Resilience)
+
+	// Authentication
+	authenticator, err := auth.New(configs.Auth)
+	if err != nil {
+		logInternal.
+			Fatal().
+			Str("Error", err.Error()).
+			Msg("Failed to load authentication credentials")
+	}
+
+	// SSM API keys may be unavailable during a failover; serve the static keys and JWT, fail
+	// readiness only when there is nothing else to authenticate with and keep refreshing them
+	if err := authenticator.Refresh(); err != nil {
+		logInternal.
+			Warn().
+			Str("Parameter", configs.Auth.ApiKeysParameter).
+			Str("Error", err.Error()).
+			Bool("Ready", authenticator.Ready()).
+			Msg("API keys not loaded from SSM; serving the static keys and JWT until they are")
+	}
+	readiness.AddCheck("auth", authenticator.Ready)
+	go authenticator.RefreshEvery(context.Background(), time.Minute, func(err error) {
+		logInternal.
+			Warn().
+			Str("Parameter", configs.Auth.ApiKeysParameter).
+			Str("Error", err.Error()).
+			Msg("Failed to refresh API keys from SSM; keeping the last known keys")
+	})
+
+	// Sale Events Encoding
+	if _, err := codec.Setup(configs.EventEncoding); err != nil {
+		logInternal.
+			Fatal().
+			Str("Error", err.Error()).
+			Msg("Failed to select event encoding")
+	}
+
+	// Sale Events Publisher
+	sale_publisher, err := publisher.Setup(configs.Publisher)
+	if err != nil {
+		logInternal.
+			Fatal().
+			Str("Error", err.Error()).
+			Msg("Failed to create sale events publisher")
+	}
+
+	logInternal.
+		Info().
+		Str("Publisher", sale_publisher.String()).
+		Msg("Sale events publisher configured")
+
+	// Rate Limit
+	limiter, err := rate_limit.New(configs.RateLimit)
+	if err != nil {
+		logInternal.
+			Fatal().
+			Str("Error", err.Error()).
+			Msg("Failed to create rate limiter")
+	}
 
 	//Middlewares
 	router.Use(p.Instrument())
 	router.Use(gin.Recovery())
 	router.Use(chaos.Load())
-	router.Use(middlewares.JsonLoggerMiddleware())
+	router.Use(middlewares.ContextLoggerMiddleware())
+	router.Use(middlewares.JsonLoggerMiddleware(configs.AccessLog))
+	router.Use(middlewares.TimeoutMiddleware(configs.Timeouts))
+	if configs.RateLimit.Enabled {
+		router.Use(middlewares.RateLimitMiddleware(limiter, authenticator))
+	}
 
 	//Swagger
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -110,10 +179,14 @@ func main() {
 	// Version
 	router.GET("/version", version.Get)
 
+	// Admin
+	router.GET("/admin/log-level", middlewares.AuthMiddleware(authenticator, auth.ScopeAdminSite), log_level.Get)
+	router.PUT("/admin/log-level", middlewares.AuthMiddleware(authenticator, auth.ScopeAdminSite), log_level.Update)
+
 	// Sales
-	router.POST("/sales", sales.Create)
-	router.GET("/sales/:id", sales.GetByID)
-	router.DELETE("/sales/:id", sales.DeleteById)
+	router.POST("/sales", middlewares.AuthMiddleware(authenticator, auth.ScopeSalesWrite), sales.Create)
+	router.GET("/sales/:id", middlewares.AuthMiddleware(authenticator, auth.ScopeSalesRead), sales.GetByID)
+	router.DELETE("/sales/:id", middlewares.AuthMiddleware(authenticator, auth.ScopeSalesDelete), sales.DeleteById)
 
 	// Graceful Shutdown Config
 	srv := &http.Server{
@@ -149,6 +222,8 @@ func main() {
 			Msg("Server forced to shutdown: ")
 	}
 
-	fmt.Println("Server exiting")
+	logInternal.
+		Info().
+		Msg("Server exiting")
 
 }
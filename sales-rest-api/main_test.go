@@ -1,9 +1,38 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/msfidelis/sales-rest-api/middlewares"
+	"github.com/msfidelis/sales-rest-api/pkg/auth"
+	"github.com/msfidelis/sales-rest-api/pkg/codec"
 	"github.com/msfidelis/sales-rest-api/pkg/configuration"
+	"github.com/msfidelis/sales-rest-api/pkg/events"
+	"github.com/msfidelis/sales-rest-api/pkg/log"
+	"github.com/msfidelis/sales-rest-api/pkg/publisher"
+	"github.com/msfidelis/sales-rest-api/pkg/rate_limit"
+	"github.com/msfidelis/sales-rest-api/pkg/resilience"
+	"github.com/msfidelis/sales-rest-api/pkg/sns"
+	"github.com/msfidelis/sales-rest-api/pkg/sqs"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 func TestPkgConfigurationLoad(t *testing.T) {
@@ -26,4 +55,606 @@ func TestPkgConfigurationLoad(t *testing.T) {
 		}
 	})
 
+	t.Run("Access Log Sample Rate Set", func(t *testing.T) {
+		configs := configuration.Load()
+		rate := configs.AccessLog.SuccessSampleRate
+		if rate == nil || *rate != 1 {
+			t.Errorf("got %v want 1", rate)
+		}
+	})
+
+}
+
+func TestPkgLogLevel(t *testing.T) {
+
+	t.Run("Change Level At Runtime", func(t *testing.T) {
+		err := log.SetLevel("warn")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := log.GetLevel()
+		want := "warn"
+		if got != want {
+			t.Errorf("got %q want %q", got, want)
+		}
+	})
+
+	t.Run("Reject Unknown Level", func(t *testing.T) {
+		err := log.SetLevel("verbose")
+		if err == nil {
+			t.Errorf("expected error for unknown level")
+		}
+	})
+
+}
+
+func TestPkgAuth(t *testing.T) {
+
+	private_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": "test",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(private_key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(private_key.E)).Bytes()),
+		}},
+	})
+	jwks_file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwks_file, jwks, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err := auth.New(auth.Config{
+		Enabled:  true,
+		ApiKeys:  []auth.ApiKey{{Name: "k6", Hash: auth.HashApiKey("secret"), Scopes: []string{auth.ScopeSalesWrite}}},
+		JWKSFile: jwks_file,
+		Audience: "sales-rest-api",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Ready Without SSM Parameter", func(t *testing.T) {
+		if !authenticator.Ready() {
+			t.Errorf("authenticator with static keys should be ready")
+		}
+	})
+
+	t.Run("Ready Before SSM Keys Load", func(t *testing.T) {
+		// SSM is only read by Refresh; the static keys and JWKS keep the API ready meanwhile
+		with_fallback, err := auth.New(auth.Config{
+			Enabled:          true,
+			ApiKeys:          []auth.ApiKey{{Name: "k6", Hash: auth.HashApiKey("secret")}},
+			ApiKeysParameter: "/sales-rest-api/api-keys",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if with_fallback.Loaded() || !with_fallback.Ready() {
+			t.Errorf("got loaded %v ready %v want false true", with_fallback.Loaded(), with_fallback.Ready())
+		}
+
+		only_ssm, err := auth.New(auth.Config{Enabled: true, ApiKeysParameter: "/sales-rest-api/api-keys"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if only_ssm.Ready() {
+			t.Errorf("authenticator without keys should not be ready before SSM loads")
+		}
+	})
+
+	t.Run("Authenticate API Key", func(t *testing.T) {
+		request := httptest.NewRequest("POST", "/sales", nil)
+		request.Header.Set(auth.ApiKeyHeader, "secret")
+		principal, err := authenticator.Authenticate(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if principal.Subject != "k6" || !principal.HasScope(auth.ScopeSalesWrite) {
+			t.Errorf("unexpected principal %+v", principal)
+		}
+	})
+
+	t.Run("Reject Unknown API Key", func(t *testing.T) {
+		request := httptest.NewRequest("POST", "/sales", nil)
+		request.Header.Set(auth.ApiKeyHeader, "wrong")
+		_, err := authenticator.Authenticate(request)
+		if err != auth.ErrInvalidCredentials {
+			t.Errorf("got %v want %v", err, auth.ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("Authenticate JWT Bearer", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"sub":   "operator",
+			"aud":   "sales-rest-api",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"scope": "sales:read admin:site",
+		})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(private_key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request := httptest.NewRequest("GET", "/sales/1", nil)
+		request.Header.Set("Authorization", "Bearer "+signed)
+		principal, err := authenticator.Authenticate(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if principal.Subject != "operator" || !principal.HasScope(auth.ScopeAdminSite) || principal.HasScope(auth.ScopeSalesDelete) {
+			t.Errorf("unexpected principal %+v", principal)
+		}
+	})
+
+	t.Run("Reject Missing Credentials", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/sales/1", nil)
+		_, err := authenticator.Authenticate(request)
+		if err != auth.ErrMissingCredentials {
+			t.Errorf("got %v want %v", err, auth.ErrMissingCredentials)
+		}
+	})
+
+}
+
+func TestPkgRateLimit(t *testing.T) {
+
+	redis_server := miniredis.RunT(t)
+
+	stores := map[string]rate_limit.Store{
+		"Memory": rate_limit.NewMemoryStore(),
+		"Redis":  rate_limit.NewRedisStore(redis_server.Addr()),
+	}
+
+	for name, store := range stores {
+		t.Run(name+" Store Token Bucket", func(t *testing.T) {
+			limit := rate_limit.Limit{Rate: 1, Burst: 2}
+			now := time.Now()
+
+			for i := 0; i < 2; i++ {
+				result, err := store.Take("bucket", limit, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.Allowed {
+					t.Fatalf("request %d should be allowed", i)
+				}
+			}
+
+			result, err := store.Take("bucket", limit, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed || result.Remaining != 0 || result.RetryAfter != time.Second {
+				t.Errorf("unexpected result on empty bucket %+v", result)
+			}
+
+			result, err = store.Take("bucket", limit, now.Add(time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Allowed {
+				t.Errorf("bucket should be refilled after one second")
+			}
+		})
+	}
+
+	t.Run("Unknown API Keys Share The Client IP Bucket", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		authenticator, err := auth.New(auth.Config{Enabled: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		limiter := rate_limit.NewWithStore(rate_limit.NewMemoryStore(), rate_limit.Config{
+			Routes: map[string]rate_limit.Limit{"POST /sales": {Rate: 1, Burst: 2}},
+		})
+
+		router := gin.New()
+		router.Use(middlewares.RateLimitMiddleware(limiter, authenticator))
+		router.POST("/sales", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+		codes := []int{}
+		for i := 0; i < 3; i++ {
+			request := httptest.NewRequest("POST", "/sales", nil)
+			request.Header.Set(auth.ApiKeyHeader, fmt.Sprintf("random-%d", i))
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			codes = append(codes, recorder.Code)
+		}
+
+		if codes[2] != http.StatusTooManyRequests {
+			t.Errorf("got %v want the third request limited", codes)
+		}
+	})
+
+	t.Run("Routes From Config", func(t *testing.T) {
+		configs := configuration.Load()
+		limit, found := configs.RateLimit.Routes["POST /sales"]
+		if !found || limit.Rate <= 0 {
+			t.Errorf("missing rate limit for POST /sales")
+		}
+	})
+
+}
+
+func TestPkgCodec(t *testing.T) {
+
+	sale := map[string]interface{}{
+		"id":             "2f9c3a5e",
+		"product":        "teste",
+		"amount":         223.34,
+		"sale_processed": false,
+		"timestamp":      int64(1689033600),
+	}
+
+	event, err := events.New(events.SaleCreated, time.Unix(1689033600, 0), sale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.SourceRegion = "sa-east-1"
+
+	for _, encoding := range []string{codec.JSON, codec.CloudEventsStructured, codec.CloudEventsBinary, codec.Protobuf} {
+		t.Run("Round Trip "+encoding, func(t *testing.T) {
+			encoder, err := codec.Get(encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			message, err := encoder.Encode(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := message.Attributes[codec.ContentTypeAttribute]; got != encoder.ContentType() {
+				t.Errorf("got content-type %q want %q", got, encoder.ContentType())
+			}
+
+			document, err := codec.ForMessage(message).Decode(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded events.Envelope
+			if err := json.Unmarshal(document, &decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			if decoded.EventID != event.EventID || decoded.SourceRegion != event.SourceRegion ||
+				decoded.SchemaVersion != event.SchemaVersion || !decoded.OccurredAt.Equal(event.OccurredAt) {
+				t.Errorf("got %+v want %+v", decoded, event)
+			}
+
+			var data map[string]interface{}
+			if err := json.Unmarshal(decoded.Data, &data); err != nil {
+				t.Fatal(err)
+			}
+			if data["id"] != sale["id"] || data["amount"] != sale["amount"] {
+				t.Errorf("got data %v want %v", data, sale)
+			}
+		})
+	}
+
+	t.Run("Protobuf Rejects Wrong Wire Type", func(t *testing.T) {
+		// Field 1 (type) is a string; a varint must fail instead of panicking
+		raw := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 7)
+		message := &codec.Message{
+			Body:       base64.StdEncoding.EncodeToString(raw),
+			Attributes: map[string]string{codec.ContentTypeAttribute: "application/x-protobuf"},
+		}
+
+		_, err := codec.ForMessage(message).Decode(message)
+		if !errors.Is(err, codec.ErrWireType) {
+			t.Errorf("got %v want %v", err, codec.ErrWireType)
+		}
+	})
+
+	mismatches := map[string][]byte{
+		// Field 3 (amount) is a double; a varint would decode into a garbage float
+		"Varint Amount": protowire.AppendVarint(protowire.AppendTag(nil, 3, protowire.VarintType), 223),
+		// Field 5 (timestamp) is an int64; a fixed64 must not pass as a varint
+		"Fixed64 Timestamp": protowire.AppendFixed64(protowire.AppendTag(nil, 5, protowire.Fixed64Type), 1689033600),
+	}
+
+	for name, sale := range mismatches {
+		t.Run("Protobuf Rejects "+name, func(t *testing.T) {
+			raw := protowire.AppendBytes(protowire.AppendTag(nil, 6, protowire.BytesType), sale)
+			message := &codec.Message{
+				Body:       base64.StdEncoding.EncodeToString(raw),
+				Attributes: map[string]string{codec.ContentTypeAttribute: "application/x-protobuf"},
+			}
+
+			_, err := codec.ForMessage(message).Decode(message)
+			if !errors.Is(err, codec.ErrWireType) {
+				t.Errorf("got %v want %v", err, codec.ErrWireType)
+			}
+		})
+	}
+
+}
+
+func TestPkgEventAttributes(t *testing.T) {
+
+	event, err := events.New(events.SaleCreated, time.Unix(1689033600, 0), map[string]interface{}{"id": "2f9c3a5e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.SourceRegion = "sa-east-1"
+
+	attributes := codec.Attributes{
+		EventType:    event.Type,
+		Product:      "teste",
+		SourceRegion: event.SourceRegion,
+		SiteState:    "active",
+	}
+
+	tests := []struct {
+		encoding string
+		present  []string
+		absent   []string
+	}{
+		{
+			encoding: codec.JSON,
+			present:  []string{codec.EventTypeAttribute, codec.ProductAttribute, codec.SourceRegionAttribute, codec.SiteStateAttribute},
+		},
+		{
+			// ce_type and ce_source already carry the type and region
+			encoding: codec.CloudEventsBinary,
+			present:  []string{codec.ProductAttribute, codec.SiteStateAttribute, "ce_type", "ce_source"},
+			absent:   []string{codec.EventTypeAttribute, codec.SourceRegionAttribute},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run("Attributes "+test.encoding, func(t *testing.T) {
+			encoder, err := codec.Get(test.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message, err := encoder.Encode(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message.SetEventAttributes(attributes)
+
+			for _, name := range test.present {
+				if _, found := message.Attributes[name]; !found {
+					t.Errorf("missing attribute %s in %v", name, message.Attributes)
+				}
+			}
+			for _, name := range test.absent {
+				if _, found := message.Attributes[name]; found {
+					t.Errorf("unexpected attribute %s in %v", name, message.Attributes)
+				}
+			}
+			if len(message.Attributes) > sns.MaxAttributes {
+				t.Errorf("got %d attributes want at most %d", len(message.Attributes), sns.MaxAttributes)
+			}
+
+			if got := message.EventAttributes(); got != attributes {
+				t.Errorf("got %+v want %+v", got, attributes)
+			}
+		})
+	}
+
+	t.Run("Attributes Over The Limit", func(t *testing.T) {
+		over := map[string]string{}
+		for i := 0; i <= sns.MaxAttributes; i++ {
+			over[fmt.Sprintf("attribute_%d", i)] = "value"
+		}
+
+		if _, err := sns.NewPublishInput("{}", "arn:aws:sns:sa-east-1:000000000000:sales", sns.WithAttributes(over)); err != sns.ErrTooManyAttributes {
+			t.Errorf("got %v want %v", err, sns.ErrTooManyAttributes)
+		}
+		if _, err := sqs.NewSendInput("{}", "https://sqs.sa-east-1.amazonaws.com/000000000000/sales", sqs.WithAttributes(over)); err != sqs.ErrTooManyAttributes {
+			t.Errorf("got %v want %v", err, sqs.ErrTooManyAttributes)
+		}
+	})
+
+}
+
+func TestPkgFIFOInput(t *testing.T) {
+
+	group_id := "2f9c3a5e"
+	deduplication_id := codec.DeduplicationId(group_id, events.SaleCreated)
+
+	t.Run("Deduplication Id", func(t *testing.T) {
+		if codec.DeduplicationId(group_id, events.SaleCreated) != deduplication_id {
+			t.Errorf("deduplication id should be stable")
+		}
+		if codec.DeduplicationId(group_id, "sale.deleted") == deduplication_id {
+			t.Errorf("events of another type should not be deduplicated")
+		}
+	})
+
+	t.Run("SNS FIFO Topic", func(t *testing.T) {
+		topic := "arn:aws:sns:sa-east-1:000000000000:sales.fifo"
+		if !sns.IsFIFO(topic) || sns.IsFIFO("arn:aws:sns:sa-east-1:000000000000:sales") {
+			t.Errorf("FIFO detection by the .fifo suffix failed")
+		}
+
+		input, err := sns.NewPublishInput("{}", topic, sns.WithFIFO(group_id, deduplication_id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if input.MessageGroupId == nil || *input.MessageGroupId != group_id ||
+			input.MessageDeduplicationId == nil || *input.MessageDeduplicationId != deduplication_id {
+			t.Errorf("unexpected FIFO ids in %v", input)
+		}
+	})
+
+	t.Run("SQS FIFO Queue", func(t *testing.T) {
+		queue := "https://sqs.sa-east-1.amazonaws.com/000000000000/sales.fifo"
+		if !sqs.IsFIFO(queue) || sqs.IsFIFO("https://sqs.sa-east-1.amazonaws.com/000000000000/sales") {
+			t.Errorf("FIFO detection by the .fifo suffix failed")
+		}
+
+		input, err := sqs.NewSendInput("{}", queue, sqs.WithFIFO(group_id, deduplication_id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if input.MessageGroupId == nil || *input.MessageGroupId != group_id ||
+			input.MessageDeduplicationId == nil || *input.MessageDeduplicationId != deduplication_id {
+			t.Errorf("unexpected FIFO ids in %v", input)
+		}
+	})
+
+	t.Run("Standard Queue Without FIFO Ids", func(t *testing.T) {
+		input, err := sqs.NewSendInput("{}", "https://sqs.sa-east-1.amazonaws.com/000000000000/sales")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if input.MessageGroupId != nil || input.MessageDeduplicationId != nil {
+			t.Errorf("unexpected FIFO ids in %v", input)
+		}
+	})
+
+}
+
+func TestPkgPublisher(t *testing.T) {
+
+	message := &codec.Message{
+		Body:       `{"id":"1"}`,
+		Attributes: map[string]string{codec.ContentTypeAttribute: "application/json"},
+		GroupId:    "1",
+	}
+
+	t.Run("File Publisher From Test Config", func(t *testing.T) {
+		os.Setenv("ENVIRONMENT", "test")
+		defer os.Unsetenv("ENVIRONMENT")
+
+		sale_publisher, err := publisher.New(configuration.Load().Publisher)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := sale_publisher.(*publisher.FilePublisher); !ok {
+			t.Fatalf("got %s want file publisher", sale_publisher)
+		}
+	})
+
+	t.Run("Memory Publisher Not Configurable", func(t *testing.T) {
+		if _, err := publisher.New(publisher.Config{Backend: "memory"}); err == nil {
+			t.Errorf("memory backend must be restricted to tests")
+		}
+	})
+
+	t.Run("Memory Publisher Fails When Full", func(t *testing.T) {
+		memory := publisher.NewMemoryPublisher(1)
+
+		if err := memory.Publish(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+		if err := memory.Publish(context.Background(), message); err != publisher.ErrBufferFull {
+			t.Errorf("got %v want %v", err, publisher.ErrBufferFull)
+		}
+
+		got := <-memory.Messages()
+		if got.Body != message.Body {
+			t.Errorf("got %q want %q", got.Body, message.Body)
+		}
+	})
+
+	t.Run("File Publisher Writes NDJSON", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "events.ndjson")
+		sale_publisher := publisher.NewFilePublisher(path)
+
+		for i := 0; i < 2; i++ {
+			if err := sale_publisher.Publish(context.Background(), message); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		lines := 0
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var record publisher.Record
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatal(err)
+			}
+			if record.Body != message.Body || record.GroupId != message.GroupId {
+				t.Errorf("unexpected record %+v", record)
+			}
+			lines++
+		}
+
+		if lines != 2 {
+			t.Errorf("got %d lines want 2", lines)
+		}
+	})
+
+}
+
+func TestPkgResilience(t *testing.T) {
+
+	throttled := awserr.New("ThrottlingException", "Rate exceeded", nil)
+
+	t.Run("Retries Throttling Errors", func(t *testing.T) {
+		resilience.Setup(resilience.Config{
+			Default: resilience.Settings{MaxAttempts: 3, BaseDelayMs: 1, MaxDelayMs: 2, FailureThreshold: 5, OpenSeconds: 30},
+		})
+
+		calls := 0
+		err := resilience.Call(context.Background(), resilience.SNS, func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return throttled
+			}
+			return nil
+		})
+
+		if err != nil || calls != 3 {
+			t.Errorf("got %d calls and %v want 3 calls and no error", calls, err)
+		}
+	})
+
+	t.Run("Does Not Retry Client Errors", func(t *testing.T) {
+		calls := 0
+		err := resilience.Call(context.Background(), resilience.DynamoDB, func(ctx context.Context) error {
+			calls++
+			return awserr.New("ValidationException", "invalid key", nil)
+		})
+
+		if err == nil || calls != 1 {
+			t.Errorf("got %d calls want 1", calls)
+		}
+		if state := resilience.GetBreaker(resilience.DynamoDB).State(); state != resilience.Closed {
+			t.Errorf("got %s want closed", state)
+		}
+	})
+
+	t.Run("Breaker Opens And Recovers", func(t *testing.T) {
+		breaker := resilience.NewBreaker("test", 2, 50*time.Millisecond)
+
+		breaker.Failure()
+		breaker.Failure()
+		if err := breaker.Allow(); err != resilience.ErrOpen {
+			t.Errorf("got %v want %v", err, resilience.ErrOpen)
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		if err := breaker.Allow(); err != nil {
+			t.Errorf("got %v want half-open probe", err)
+		}
+		if err := breaker.Allow(); err != resilience.ErrOpen {
+			t.Errorf("got %v want a single probe", err)
+		}
+
+		breaker.Success()
+		if state := breaker.State(); state != resilience.Closed {
+			t.Errorf("got %s want closed", state)
+		}
+	})
+
 }
@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msfidelis/sales-rest-api/pkg/auth"
+	"github.com/msfidelis/sales-rest-api/pkg/log"
+)
+
+// AuthMiddleware - Authenticates the request and enforces the scopes required by the route;
+// the principal is attached to the context logger so every log line of the request carries it
+func AuthMiddleware(authenticator *auth.Authenticator, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := log.FromContext(c.Request.Context())
+
+		principal, err := authenticatedPrincipal(c, authenticator)
+		if err != nil {
+			logger.Warn().
+				Str("Action", "auth").
+				Str("Error", err.Error()).
+				Msg("Request not authenticated")
+			c.Header("WWW-Authenticate", `Bearer realm="sales"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		logger = logger.With().
+			Str("Principal", principal.Subject).
+			Str("AuthMethod", principal.Method).
+			Logger()
+
+		c.Set("Principal", principal)
+		c.Request = c.Request.WithContext(log.WithContext(c.Request.Context(), logger))
+
+		if authenticator.Enabled() {
+			for _, scope := range scopes {
+				if !principal.HasScope(scope) {
+					logger.Warn().
+						Str("Action", "auth").
+						Str("Scope", scope).
+						Msg("Principal missing required scope")
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient scope"})
+					return
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// authenticatedPrincipal - Principal already resolved by RateLimitMiddleware, or authenticates
+func authenticatedPrincipal(c *gin.Context, authenticator *auth.Authenticator) (*auth.Principal, error) {
+	if value, found := c.Get("Principal"); found {
+		if principal, ok := value.(*auth.Principal); ok {
+			return principal, nil
+		}
+	}
+	return authenticator.Authenticate(c.Request)
+}
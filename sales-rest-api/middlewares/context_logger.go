@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	guuid "github.com/google/uuid"
+	"github.com/msfidelis/sales-rest-api/pkg/log"
+)
+
+const RequestIdHeader = "X-Request-Id"
+
+// ContextLoggerMiddleware - Carries the process logger and the request id through the request context
+func ContextLoggerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request_id := c.GetHeader(RequestIdHeader)
+		if request_id == "" {
+			request_id = guuid.New().String()
+		}
+
+		c.Set("RequestId", request_id)
+		c.Header(RequestIdHeader, request_id)
+
+		logger := log.Instance().With().
+			Str("RequestId", request_id).
+			Str("Method", c.Request.Method).
+			Str("Path", c.Request.URL.Path).
+			Logger()
+
+		c.Request = c.Request.WithContext(log.WithContext(c.Request.Context(), logger))
+		c.Next()
+	}
+}
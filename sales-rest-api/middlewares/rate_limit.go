@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msfidelis/sales-rest-api/pkg/auth"
+	"github.com/msfidelis/sales-rest-api/pkg/log"
+	"github.com/msfidelis/sales-rest-api/pkg/rate_limit"
+)
+
+// RateLimitMiddleware - Applies the route token bucket per authenticated principal, or per client
+// IP for anonymous calls and unknown credentials, so random keys can't get a fresh bucket each
+func RateLimitMiddleware(limiter *rate_limit.Limiter, authenticator *auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := log.FromContext(c.Request.Context())
+		route := c.Request.Method + " " + c.FullPath()
+
+		client := "ip:" + c.ClientIP()
+		if principal, err := authenticator.Authenticate(c.Request); err == nil && principal.Method != auth.MethodAnonymous {
+			client = principal.Method + ":" + principal.Subject
+			// AuthMiddleware reuses it instead of verifying the credentials again
+			c.Set("Principal", principal)
+		}
+
+		result, limited, err := limiter.Allow(route, client)
+		if err != nil {
+			// Fail open: an unavailable bucket store must not take the API down
+			logger.Error().
+				Str("Action", "rate-limit").
+				Str("Route", route).
+				Str("Error", err.Error()).
+				Msg("Error to take token from rate limit store")
+			c.Next()
+			return
+		}
+
+		if !limited {
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+
+		if !result.Allowed {
+			retry_after := strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds())))
+			c.Header("Retry-After", retry_after)
+
+			logger.Warn().
+				Str("Action", "rate-limit").
+				Str("Route", route).
+				Str("Client", client).
+				Str("RetryAfter", retry_after).
+				Msg("Rate limit exceeded")
+
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+
+		c.Next()
+	}
+}
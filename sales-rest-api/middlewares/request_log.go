@@ -1,28 +1,94 @@
 package middlewares
 
 import (
-	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/msfidelis/sales-rest-api/pkg/configuration"
+	"github.com/msfidelis/sales-rest-api/pkg/log"
+	"github.com/rs/zerolog"
 )
 
-func JsonLoggerMiddleware() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(
-		func(params gin.LogFormatterParams) string {
+const redacted = "[REDACTED]"
 
-			// fmt.Println(params)
+// JsonLoggerMiddleware - Writes one access log entry per request through the context logger;
+// request id, method and path come from ContextLoggerMiddleware
+func JsonLoggerMiddleware(config configuration.AccessLog) gin.HandlerFunc {
 
-			log := make(map[string]interface{})
+	excluded := make(map[string]bool, len(config.ExcludePaths))
+	for _, path := range config.ExcludePaths {
+		excluded[path] = true
+	}
 
-			log["status_code"] = params.StatusCode
-			log["path"] = params.Path
-			log["method"] = params.Method
-			log["start_time"] = params.TimeStamp.Format("2006-01-02 - 15:04:05")
-			log["remote_addr"] = params.ClientIP
-			log["response_time"] = params.Latency.String()
+	redact := make(map[string]bool, len(config.RedactHeaders))
+	for _, header := range config.RedactHeaders {
+		redact[http.CanonicalHeaderKey(header)] = true
+	}
 
-			s, _ := json.Marshal(log)
-			return string(s) + "\n"
-		},
-	)
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		if excluded[path] {
+			return
+		}
+
+		status := c.Writer.Status()
+
+		if status < http.StatusBadRequest && !sampled(config.SuccessSampleRate) {
+			return
+		}
+
+		logger := log.FromContext(c.Request.Context())
+
+		var event *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = logger.Error()
+		case status >= http.StatusBadRequest:
+			event = logger.Warn()
+		default:
+			event = logger.Info()
+		}
+
+		headers := zerolog.Dict()
+		for name, values := range c.Request.Header {
+			if redact[name] {
+				headers.Str(name, redacted)
+				continue
+			}
+			headers.Str(name, strings.Join(values, ","))
+		}
+
+		event.
+			Str("Action", "access").
+			Int("StatusCode", status).
+			Str("Route", c.FullPath()).
+			Str("Query", c.Request.URL.RawQuery).
+			Str("RemoteAddr", c.ClientIP()).
+			Str("UserAgent", c.Request.UserAgent()).
+			Int64("RequestSize", c.Request.ContentLength).
+			Int("ResponseSize", c.Writer.Size()).
+			Dur("Latency", time.Since(start)).
+			Str("Errors", c.Errors.ByType(gin.ErrorTypeAny).String()).
+			Dict("Headers", headers).
+			Msg("Request handled")
+	}
+}
+
+// sampled - Decides if a successful request is logged; an unset rate logs every request and
+// 0 drops them all
+func sampled(rate *float64) bool {
+	switch {
+	case rate == nil || *rate >= 1:
+		return true
+	case *rate <= 0:
+		return false
+	}
+	return rand.Float64() < *rate
 }
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/msfidelis/sales-rest-api/pkg/configuration"
+)
+
+// TimeoutMiddleware - Bounds the request context with the route deadline; the context is
+// also cancelled when the client disconnects, aborting the downstream AWS calls
+func TimeoutMiddleware(config configuration.Timeouts) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout_ms := config.DefaultMs
+		if route_timeout, found := config.Routes[c.Request.Method+" "+c.FullPath()]; found {
+			timeout_ms = route_timeout
+		}
+
+		if timeout_ms <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(timeout_ms)*time.Millisecond)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -1,11 +1,13 @@
 package sales_model
 
 import (
+	"context"
 	"os"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/msfidelis/sales-rest-api/pkg/resilience"
 )
 
 type ModelDAO struct {
@@ -22,6 +24,10 @@ func NewModelDAO(client *dynamodb.DynamoDB) *ModelDAO {
 }
 
 func (dao *ModelDAO) Create(model *Model) error {
+	return dao.CreateWithContext(context.Background(), model)
+}
+
+func (dao *ModelDAO) CreateWithContext(ctx context.Context, model *Model) error {
 	av, err := dynamodbattribute.MarshalMap(model)
 	if err != nil {
 		return err
@@ -32,11 +38,17 @@ func (dao *ModelDAO) Create(model *Model) error {
 		TableName: aws.String(dao.tableName),
 	}
 
-	_, err = dao.client.PutItem(input)
-	return err
+	return resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.PutItemWithContext(ctx, input)
+		return err
+	})
 }
 
 func (dao *ModelDAO) GetByID(id string) (*Model, error) {
+	return dao.GetByIDWithContext(context.Background(), id)
+}
+
+func (dao *ModelDAO) GetByIDWithContext(ctx context.Context, id string) (*Model, error) {
 	input := &dynamodb.QueryInput{
 		TableName:              &dao.tableName,
 		KeyConditionExpression: aws.String("id = :value"),
@@ -47,7 +59,12 @@ func (dao *ModelDAO) GetByID(id string) (*Model, error) {
 		},
 	}
 
-	result, err := dao.client.Query(input)
+	var result *dynamodb.QueryOutput
+	err := resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		var err error
+		result, err = dao.client.QueryWithContext(ctx, input)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +83,10 @@ func (dao *ModelDAO) GetByID(id string) (*Model, error) {
 }
 
 func (dao *ModelDAO) Delete(id string) error {
+	return dao.DeleteWithContext(context.Background(), id)
+}
+
+func (dao *ModelDAO) DeleteWithContext(ctx context.Context, id string) error {
 	input := &dynamodb.DeleteItemInput{
 		TableName: aws.String(dao.tableName),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -75,10 +96,8 @@ func (dao *ModelDAO) Delete(id string) error {
 		},
 	}
 
-	_, err := dao.client.DeleteItem(input)
-	if err != nil {
+	return resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.DeleteItemWithContext(ctx, input)
 		return err
-	}
-
-	return nil
+	})
 }
@@ -0,0 +1,150 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msfidelis/sales-rest-api/pkg/events"
+)
+
+const (
+	jsonContentType        = "application/json"
+	cloudEventsContentType = "application/cloudevents+json"
+	cloudEventsSpecVersion = "1.0"
+
+	// cloudEventsAttributePrefix - Binary mode carries the context attributes as ce_ message attributes;
+	// SNS delivers at most 10 attributes, so only the required ones and schemaversion are sent
+	cloudEventsAttributePrefix = "ce_"
+)
+
+// cloudEvent - CloudEvents 1.0 JSON format; schemaversion and sourceregion are extension attributes
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	ID              string          `json:"id"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	SchemaVersion   int             `json:"schemaversion"`
+	SourceRegion    string          `json:"sourceregion"`
+	Data            json.RawMessage `json:"data"`
+}
+
+func source(region string) string {
+	return "/sales-rest-api/" + region
+}
+
+func dataSchema(event *events.Envelope) string {
+	return fmt.Sprintf("%s.v%d.json", event.Type, event.SchemaVersion)
+}
+
+type cloudEventsStructuredCodec struct{}
+
+func (cloudEventsStructuredCodec) ContentType() string {
+	return cloudEventsContentType
+}
+
+func (c cloudEventsStructuredCodec) Encode(event *events.Envelope) (*Message, error) {
+	body, err := json.Marshal(cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		Type:            event.Type,
+		Source:          source(event.SourceRegion),
+		ID:              event.EventID,
+		Time:            event.OccurredAt,
+		DataContentType: jsonContentType,
+		DataSchema:      dataSchema(event),
+		SchemaVersion:   event.SchemaVersion,
+		SourceRegion:    event.SourceRegion,
+		Data:            event.Data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Body:       string(body),
+		Attributes: map[string]string{ContentTypeAttribute: c.ContentType()},
+	}, nil
+}
+
+func (cloudEventsStructuredCodec) Decode(message *Message) ([]byte, error) {
+	var ce cloudEvent
+	if err := json.Unmarshal([]byte(message.Body), &ce); err != nil {
+		return nil, err
+	}
+
+	if ce.SpecVersion != cloudEventsSpecVersion {
+		return nil, fmt.Errorf("unsupported cloudevents specversion %q", ce.SpecVersion)
+	}
+
+	return marshal(&events.Envelope{
+		Type:          ce.Type,
+		SchemaVersion: ce.SchemaVersion,
+		EventID:       ce.ID,
+		SourceRegion:  ce.SourceRegion,
+		OccurredAt:    ce.Time,
+		Data:          ce.Data,
+	})
+}
+
+type cloudEventsBinaryCodec struct{}
+
+func (cloudEventsBinaryCodec) ContentType() string {
+	return jsonContentType
+}
+
+func (c cloudEventsBinaryCodec) Encode(event *events.Envelope) (*Message, error) {
+	return &Message{
+		Body: string(event.Data),
+		Attributes: map[string]string{
+			ContentTypeAttribute:                         c.ContentType(),
+			cloudEventsAttributePrefix + "specversion":   cloudEventsSpecVersion,
+			cloudEventsAttributePrefix + "type":          event.Type,
+			cloudEventsAttributePrefix + "source":        source(event.SourceRegion),
+			cloudEventsAttributePrefix + "id":            event.EventID,
+			cloudEventsAttributePrefix + "time":          event.OccurredAt.Format(time.RFC3339Nano),
+			cloudEventsAttributePrefix + "schemaversion": strconv.Itoa(event.SchemaVersion),
+		},
+	}, nil
+}
+
+func (cloudEventsBinaryCodec) Decode(message *Message) ([]byte, error) {
+	attribute := func(name string) string {
+		return message.Attributes[cloudEventsAttributePrefix+name]
+	}
+
+	if attribute("specversion") != cloudEventsSpecVersion {
+		return nil, fmt.Errorf("unsupported cloudevents specversion %q", attribute("specversion"))
+	}
+
+	if content_type := message.Attributes[ContentTypeAttribute]; content_type != "" && !strings.HasPrefix(content_type, jsonContentType) {
+		return nil, fmt.Errorf("unsupported cloudevents data content type %q", content_type)
+	}
+
+	occurred_at, err := time.Parse(time.RFC3339Nano, attribute("time"))
+	if err != nil {
+		return nil, err
+	}
+
+	schema_version, err := strconv.Atoi(attribute("schemaversion"))
+	if err != nil {
+		return nil, err
+	}
+
+	return marshal(&events.Envelope{
+		Type:          attribute("type"),
+		SchemaVersion: schema_version,
+		EventID:       attribute("id"),
+		SourceRegion:  strings.TrimPrefix(attribute("source"), source("")),
+		OccurredAt:    occurred_at,
+		Data:          json.RawMessage(message.Body),
+	})
+}
+
+func marshal(event *events.Envelope) ([]byte, error) {
+	return json.Marshal(event)
+}
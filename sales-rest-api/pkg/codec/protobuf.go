@@ -0,0 +1,245 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/msfidelis/sales-rest-api/pkg/events"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufContentType - Body is the base64 encoded sales.events.v1.Envelope of sales_events.proto
+const protobufContentType = "application/x-protobuf"
+
+// sale - JSON data of the sale events, mirrored by the Sale message
+type sale struct {
+	ID        string  `json:"id"`
+	Product   string  `json:"product"`
+	Amount    float64 `json:"amount"`
+	Processed bool    `json:"sale_processed"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string {
+	return protobufContentType
+}
+
+func (c protobufCodec) Encode(event *events.Envelope) (*Message, error) {
+	if event.Type != events.SaleCreated {
+		return nil, fmt.Errorf("protobuf encoding not supported for %s", event.Type)
+	}
+
+	var data sale
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return nil, err
+	}
+
+	var timestamp []byte
+	timestamp = appendVarintField(timestamp, 1, uint64(event.OccurredAt.Unix()))
+	timestamp = appendVarintField(timestamp, 2, uint64(event.OccurredAt.Nanosecond()))
+
+	var payload []byte
+	payload = appendStringField(payload, 1, data.ID)
+	payload = appendStringField(payload, 2, data.Product)
+	if data.Amount != 0 {
+		payload = protowire.AppendTag(payload, 3, protowire.Fixed64Type)
+		payload = protowire.AppendFixed64(payload, math.Float64bits(data.Amount))
+	}
+	if data.Processed {
+		payload = appendVarintField(payload, 4, 1)
+	}
+	payload = appendVarintField(payload, 5, uint64(data.Timestamp))
+
+	var envelope []byte
+	envelope = appendStringField(envelope, 1, event.Type)
+	envelope = appendVarintField(envelope, 2, uint64(event.SchemaVersion))
+	envelope = appendStringField(envelope, 3, event.EventID)
+	envelope = appendStringField(envelope, 4, event.SourceRegion)
+	envelope = protowire.AppendTag(envelope, 5, protowire.BytesType)
+	envelope = protowire.AppendBytes(envelope, timestamp)
+	envelope = protowire.AppendTag(envelope, 6, protowire.BytesType)
+	envelope = protowire.AppendBytes(envelope, payload)
+
+	return &Message{
+		Body:       base64.StdEncoding.EncodeToString(envelope),
+		Attributes: map[string]string{ContentTypeAttribute: c.ContentType()},
+	}, nil
+}
+
+func (protobufCodec) Decode(message *Message) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(message.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &events.Envelope{}
+	var data sale
+
+	err = consumeFields(raw, func(number protowire.Number, wire_type protowire.Type, value interface{}) error {
+		var err error
+		switch number {
+		case 1:
+			event.Type, err = stringField(number, wire_type, value)
+		case 2:
+			var version uint64
+			version, err = varintField(number, wire_type, value)
+			event.SchemaVersion = int(int32(version))
+		case 3:
+			event.EventID, err = stringField(number, wire_type, value)
+		case 4:
+			event.SourceRegion, err = stringField(number, wire_type, value)
+		case 5:
+			var timestamp []byte
+			if timestamp, err = bytesField(number, wire_type, value); err != nil {
+				return err
+			}
+			var seconds, nanos uint64
+			err = consumeFields(timestamp, func(number protowire.Number, wire_type protowire.Type, value interface{}) error {
+				var err error
+				switch number {
+				case 1:
+					seconds, err = varintField(number, wire_type, value)
+				case 2:
+					nanos, err = varintField(number, wire_type, value)
+				}
+				return err
+			})
+			event.OccurredAt = time.Unix(int64(seconds), int64(int32(nanos))).UTC()
+		case 6:
+			var sale_data []byte
+			if sale_data, err = bytesField(number, wire_type, value); err != nil {
+				return err
+			}
+			err = consumeFields(sale_data, func(number protowire.Number, wire_type protowire.Type, value interface{}) error {
+				var err error
+				var v uint64
+				switch number {
+				case 1:
+					data.ID, err = stringField(number, wire_type, value)
+				case 2:
+					data.Product, err = stringField(number, wire_type, value)
+				case 3:
+					v, err = fixed64Field(number, wire_type, value)
+					data.Amount = math.Float64frombits(v)
+				case 4:
+					v, err = varintField(number, wire_type, value)
+					data.Processed = v != 0
+				case 5:
+					v, err = varintField(number, wire_type, value)
+					data.Timestamp = int64(v)
+				}
+				return err
+			})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	event.Data, err = json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return marshal(event)
+}
+
+func appendStringField(b []byte, number protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendVarintField(b []byte, number protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+// ErrWireType - A field arrived with a wire type its schema doesn't allow
+var ErrWireType = errors.New("unexpected protobuf wire type")
+
+func bytesField(number protowire.Number, wire_type protowire.Type, value interface{}) ([]byte, error) {
+	if wire_type != protowire.BytesType {
+		return nil, fmt.Errorf("%w: field %d is not length delimited", ErrWireType, number)
+	}
+	return value.([]byte), nil
+}
+
+func stringField(number protowire.Number, wire_type protowire.Type, value interface{}) (string, error) {
+	b, err := bytesField(number, wire_type, value)
+	return string(b), err
+}
+
+// varintField - Integer and bool fields
+func varintField(number protowire.Number, wire_type protowire.Type, value interface{}) (uint64, error) {
+	if wire_type != protowire.VarintType {
+		return 0, fmt.Errorf("%w: field %d is not a varint", ErrWireType, number)
+	}
+	return value.(uint64), nil
+}
+
+// fixed64Field - Double fields
+func fixed64Field(number protowire.Number, wire_type protowire.Type, value interface{}) (uint64, error) {
+	if wire_type != protowire.Fixed64Type {
+		return 0, fmt.Errorf("%w: field %d is not a fixed64", ErrWireType, number)
+	}
+	return value.(uint64), nil
+}
+
+// consumeFields - Walks the fields of a message passing their wire type, with varints and fixed64 as uint64
+// and length delimited as []byte
+func consumeFields(b []byte, field func(number protowire.Number, wire_type protowire.Type, value interface{}) error) error {
+	for len(b) > 0 {
+		number, wire_type, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var value interface{}
+		switch wire_type {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value, b = v, b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value, b = v, b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value, b = v, b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(number, wire_type, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		if err := field(number, wire_type, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,13 +5,39 @@ import (
 	"os"
 	"strings"
 
+	"github.com/msfidelis/sales-rest-api/pkg/auth"
+	"github.com/msfidelis/sales-rest-api/pkg/publisher"
+	"github.com/msfidelis/sales-rest-api/pkg/rate_limit"
+	"github.com/msfidelis/sales-rest-api/pkg/resilience"
 	"github.com/tkanos/gonfig"
 )
 
 type Configuration struct {
-	Env         string
-	Version     string
-	Application string
+	Env           string
+	Version       string
+	Application   string
+	LogLevel      string `env:"LOG_LEVEL"`
+	LogFormat     string `env:"LOG_FORMAT"`
+	EventEncoding string `env:"EVENT_ENCODING"`
+	Publisher     publisher.Config
+	AccessLog     AccessLog
+	Auth          auth.Config
+	RateLimit     rate_limit.Config
+	Resilience    resilience.Config
+	Timeouts      Timeouts
+}
+
+type AccessLog struct {
+	ExcludePaths []string
+	// SuccessSampleRate - Fraction of successful requests logged; unset logs all, 0 logs none
+	SuccessSampleRate *float64
+	RedactHeaders     []string
+}
+
+// Timeouts - Request deadlines in milliseconds, by "METHOD /route" with a default
+type Timeouts struct {
+	DefaultMs int
+	Routes    map[string]int
 }
 
 func Load() Configuration {
@@ -0,0 +1,43 @@
+package events
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	guuid "github.com/google/uuid"
+)
+
+const (
+	SaleCreated = "sale.created"
+
+	// SchemaVersion - Version of the envelope and data schemas published by this service
+	SchemaVersion = 1
+)
+
+// Envelope - Versioned wrapper of every sale event; schemas are shipped with the sales-worker
+type Envelope struct {
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	EventID       string          `json:"event_id"`
+	SourceRegion  string          `json:"source_region"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// New - Wraps data into an envelope of the given type issued by the current region
+func New(event_type string, occurred_at time.Time, data interface{}) (*Envelope, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		Type:          event_type,
+		SchemaVersion: SchemaVersion,
+		EventID:       guuid.New().String(),
+		SourceRegion:  os.Getenv("AWS_REGION"),
+		OccurredAt:    occurred_at.UTC(),
+		Data:          raw,
+	}, nil
+}
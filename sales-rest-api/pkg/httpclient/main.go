@@ -5,13 +5,14 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"sales-rest-api/pkg/logger"
 	"strings"
+
+	"github.com/msfidelis/sales-rest-api/pkg/log"
 )
 
 func Request(method string, host string, path string, headers map[string][]string, body string) (*http.Response, string) {
 
-	log := logger.Instance()
+	log := log.Instance()
 	log.Info().
 		Str("action", "request").
 		Str("method", strings.ToUpper(method)).
@@ -1,13 +1,134 @@
 package log
 
 import (
+	"context"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/rs/zerolog"
+	globalLog "github.com/rs/zerolog/log"
 )
 
-func Instance() zerolog.Logger {
+// Config - Logger settings shared by the sales services
+type Config struct {
+	Service string
+	Version string
+	Region  string
+	Level   string
+	Format  string
+}
+
+type contextKey struct{}
+
+var (
+	mutex    sync.RWMutex
+	instance zerolog.Logger
+	state    string
+)
+
+func init() {
+	Setup(Config{
+		Region: os.Getenv("AWS_REGION"),
+	})
+}
+
+// Setup - Configures the process logger with level, format and the default fields
+func Setup(config Config) zerolog.Logger {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+	level, err := zerolog.ParseLevel(strings.ToLower(config.Level))
+	if err != nil || config.Level == "" {
+		level = zerolog.InfoLevel
+	}
+	zerolog.SetGlobalLevel(level)
+
+	var logger zerolog.Logger
+	if strings.ToLower(config.Format) == "console" {
+		logger = zerolog.New(zerolog.ConsoleWriter{
+			Out:     os.Stderr,
+			NoColor: false,
+		})
+	} else {
+		logger = zerolog.New(os.Stderr)
+	}
+
+	fields := logger.With().Timestamp()
+	if config.Service != "" {
+		fields = fields.Str("Service", config.Service)
+	}
+	if config.Version != "" {
+		fields = fields.Str("Version", config.Version)
+	}
+	if config.Region != "" {
+		fields = fields.Str("Region", config.Region)
+	}
+	logger = fields.Logger().Hook(stateHook{})
+
+	mutex.Lock()
+	instance = logger
+	mutex.Unlock()
+
+	globalLog.Logger = logger
+
 	return logger
 }
+
+// Instance - Returns the process logger configured by Setup
+func Instance() zerolog.Logger {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return instance
+}
+
+// SetState - Updates the site state attached to every log entry
+func SetState(value string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	state = value
+}
+
+// State - Returns the site state attached to log entries
+func State() string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return state
+}
+
+// SetLevel - Changes the log level of the process at runtime
+func SetLevel(value string) error {
+	level, err := zerolog.ParseLevel(strings.ToLower(value))
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(level)
+	return nil
+}
+
+// GetLevel - Returns the current log level of the process
+func GetLevel() string {
+	return zerolog.GlobalLevel().String()
+}
+
+// WithContext - Returns a copy of ctx carrying the logger
+func WithContext(ctx context.Context, logger zerolog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext - Returns the logger carried by ctx, or the process logger
+func FromContext(ctx context.Context) zerolog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(zerolog.Logger); ok {
+			return logger
+		}
+	}
+	return Instance()
+}
+
+type stateHook struct{}
+
+func (h stateHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if value := State(); value != "" {
+		e.Str("State", value)
+	}
+}
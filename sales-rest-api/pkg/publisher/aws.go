@@ -0,0 +1,55 @@
+package publisher
+
+import (
+	"context"
+
+	"github.com/msfidelis/sales-rest-api/pkg/codec"
+	"github.com/msfidelis/sales-rest-api/pkg/sns"
+	"github.com/msfidelis/sales-rest-api/pkg/sqs"
+)
+
+// SNSPublisher - Fan-out through the sales processing topic
+type SNSPublisher struct {
+	topic string
+}
+
+func NewSNSPublisher(topic string) *SNSPublisher {
+	return &SNSPublisher{topic: topic}
+}
+
+func (p *SNSPublisher) Publish(ctx context.Context, message *codec.Message) error {
+	options := []sns.PublishOption{sns.WithAttributes(message.Attributes)}
+	if sns.IsFIFO(p.topic) {
+		options = append(options, sns.WithFIFO(message.GroupId, message.DeduplicationId))
+	}
+
+	_, err := sns.PublishWithContext(ctx, message.Body, p.topic, options...)
+	return err
+}
+
+func (p *SNSPublisher) String() string {
+	return "sns:" + p.topic
+}
+
+// SQSPublisher - Direct send to the worker queue for single-consumer setups
+type SQSPublisher struct {
+	queue string
+}
+
+func NewSQSPublisher(queue string) *SQSPublisher {
+	return &SQSPublisher{queue: queue}
+}
+
+func (p *SQSPublisher) Publish(ctx context.Context, message *codec.Message) error {
+	options := []sqs.SendOption{sqs.WithAttributes(message.Attributes)}
+	if sqs.IsFIFO(p.queue) {
+		options = append(options, sqs.WithFIFO(message.GroupId, message.DeduplicationId))
+	}
+
+	_, err := sqs.SendWithContext(ctx, message.Body, p.queue, options...)
+	return err
+}
+
+func (p *SQSPublisher) String() string {
+	return "sqs:" + p.queue
+}
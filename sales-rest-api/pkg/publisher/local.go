@@ -0,0 +1,105 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/msfidelis/sales-rest-api/pkg/codec"
+)
+
+var ErrBufferFull = errors.New("memory publisher buffer is full")
+
+// Record - NDJSON line written by the file publisher
+type Record struct {
+	Body            string            `json:"body"`
+	Attributes      map[string]string `json:"attributes,omitempty"`
+	GroupId         string            `json:"group_id,omitempty"`
+	DeduplicationId string            `json:"deduplication_id,omitempty"`
+	PublishedAt     time.Time         `json:"published_at"`
+}
+
+// FilePublisher - Appends every message as one NDJSON line to a local file
+type FilePublisher struct {
+	mutex sync.Mutex
+	path  string
+}
+
+func NewFilePublisher(path string) *FilePublisher {
+	return &FilePublisher{path: path}
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, message *codec.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(Record{
+		Body:            message.Body,
+		Attributes:      message.Attributes,
+		GroupId:         message.GroupId,
+		DeduplicationId: message.DeduplicationId,
+		PublishedAt:     time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	file, err := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (p *FilePublisher) String() string {
+	return "file:" + p.path
+}
+
+// MemoryPublisher - Buffered in-process channel for tests, installed with SetInstance; nothing
+// reads Messages in the API until the local mode lands, so it isn't selectable from config
+type MemoryPublisher struct {
+	messages chan *codec.Message
+}
+
+func NewMemoryPublisher(buffer_size int) *MemoryPublisher {
+	if buffer_size <= 0 {
+		buffer_size = 1000
+	}
+	return &MemoryPublisher{messages: make(chan *codec.Message, buffer_size)}
+}
+
+// Publish - Never blocks the request; fails when the consumers fall behind the buffer
+func (p *MemoryPublisher) Publish(ctx context.Context, message *codec.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case p.messages <- message:
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+// Messages - Channel of published messages, in publish order
+func (p *MemoryPublisher) Messages() <-chan *codec.Message {
+	return p.messages
+}
+
+func (p *MemoryPublisher) String() string {
+	return "memory"
+}
@@ -0,0 +1,95 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/msfidelis/sales-rest-api/pkg/codec"
+)
+
+// Backends selectable in config. The in-memory publisher is not one of them: the one-binary
+// local mode that would consume it, running the worker processing behind POST /sales with no
+// AWS, is split out and not delivered yet, since the API and the worker are separate modules
+// and both keep the sales in DynamoDB
+const (
+	SNS  = "sns"
+	SQS  = "sqs"
+	File = "file"
+)
+
+// Publisher - Delivers encoded sale events to their consumers
+type Publisher interface {
+	Publish(ctx context.Context, message *codec.Message) error
+	String() string
+}
+
+// Config - Publisher backend; topic and queue default to SNS_SALES_PROCESSING_TOPIC and SQS_SALES_QUEUE
+type Config struct {
+	Backend string
+	Topic   string
+	Queue   string
+	File    string
+}
+
+var (
+	mutex    sync.RWMutex
+	instance Publisher
+)
+
+// New - Builds the publisher of the backend selected in config
+func New(config Config) (Publisher, error) {
+	switch config.Backend {
+	case "", SNS:
+		topic := config.Topic
+		if topic == "" {
+			topic = os.Getenv("SNS_SALES_PROCESSING_TOPIC")
+		}
+		return NewSNSPublisher(topic), nil
+	case SQS:
+		queue := config.Queue
+		if queue == "" {
+			queue = os.Getenv("SQS_SALES_QUEUE")
+		}
+		return NewSQSPublisher(queue), nil
+	case File:
+		if config.File == "" {
+			return nil, errors.New("file publisher requires a file path")
+		}
+		return NewFilePublisher(config.File), nil
+	default:
+		return nil, fmt.Errorf("unknown publisher backend %q", config.Backend)
+	}
+}
+
+// Setup - Builds the publisher from config and keeps it as the process singleton
+func Setup(config Config) (Publisher, error) {
+	publisher, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+	SetInstance(publisher)
+	return publisher, nil
+}
+
+// SetInstance - Replaces the process publisher; used by tests
+func SetInstance(publisher Publisher) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	instance = publisher
+}
+
+// GetInstance - Publisher Singleton - Defaults to SNS when Setup was not called
+func GetInstance() Publisher {
+	mutex.RLock()
+	current := instance
+	mutex.RUnlock()
+
+	if current == nil {
+		current, _ = New(Config{})
+		SetInstance(current)
+	}
+	return current
+}
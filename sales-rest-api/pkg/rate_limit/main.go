@@ -0,0 +1,110 @@
+package rate_limit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Limit - Token bucket refilled at Rate tokens per second holding up to Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result - Outcome of a take operation on a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store - Keeps the token buckets; implementations must be safe for concurrent use
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Config - Rate limiting settings; routes are keyed by "METHOD /route/template"
+type Config struct {
+	Enabled      bool
+	Store        string
+	RedisAddress string
+	Default      Limit
+	Routes       map[string]Limit
+}
+
+type Limiter struct {
+	store    Store
+	fallback Limit
+	routes   map[string]Limit
+}
+
+// New - Builds a Limiter backed by the store selected in config ("memory" or "redis")
+func New(config Config) (*Limiter, error) {
+	var store Store
+
+	switch config.Store {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "redis":
+		store = NewRedisStore(config.RedisAddress)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", config.Store)
+	}
+
+	return NewWithStore(store, config), nil
+}
+
+// NewWithStore - Builds a Limiter over an already created store
+func NewWithStore(store Store, config Config) *Limiter {
+	return &Limiter{
+		store:    store,
+		fallback: config.Default,
+		routes:   config.Routes,
+	}
+}
+
+// Allow - Takes one token for the client on the route; routes without a limit are always allowed
+func (l *Limiter) Allow(route string, client string) (Result, bool, error) {
+	limit, found := l.routes[route]
+	if !found {
+		limit = l.fallback
+	}
+
+	if limit.Rate <= 0 || limit.Burst <= 0 {
+		return Result{Allowed: true}, false, nil
+	}
+
+	result, err := l.store.Take(fmt.Sprintf("ratelimit:%s:%s", route, client), limit, time.Now())
+	return result, true, err
+}
+
+// refill - Token bucket arithmetic shared by the stores
+func refill(tokens float64, updated time.Time, limit Limit, now time.Time) float64 {
+	elapsed := now.Sub(updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+}
+
+// result - Builds the Result of a bucket after the take attempt
+func result(allowed bool, tokens float64, limit Limit) Result {
+	missing := float64(limit.Burst) - tokens
+	reset := time.Duration(missing / limit.Rate * float64(time.Second))
+
+	var retry_after time.Duration
+	if !allowed {
+		retry_after = time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	}
+
+	return Result{
+		Allowed:    allowed,
+		Limit:      limit.Burst,
+		Remaining:  int(math.Floor(tokens)),
+		Reset:      reset,
+		RetryAfter: retry_after,
+	}
+}
@@ -0,0 +1,48 @@
+package rate_limit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/msfidelis/sales-rest-api/pkg/memory_cache"
+	"github.com/patrickmn/go-cache"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore - In-process buckets kept on the memory cache singleton
+type MemoryStore struct {
+	mutex sync.Mutex
+	cache *cache.Cache
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		cache: memory_cache.GetInstance(),
+	}
+}
+
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tokens := float64(limit.Burst)
+	if value, found := s.cache.Get(key); found {
+		current := value.(bucket)
+		tokens = refill(current.tokens, current.updated, limit, now)
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	// The bucket is full again after this period, so it can be forgotten
+	ttl := time.Duration((float64(limit.Burst)-tokens)/limit.Rate*float64(time.Second)) + time.Second
+	s.cache.Set(key, bucket{tokens: tokens, updated: now}, ttl)
+
+	return result(allowed, tokens, limit), nil
+}
@@ -0,0 +1,74 @@
+package rate_limit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript - Atomic token bucket on a hash holding tokens and the last update in milliseconds
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+
+if tokens == nil then
+	tokens = burst
+else
+	local elapsed = math.max(0, now - updated) / 1000
+	tokens = math.min(burst, tokens + elapsed * rate)
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore - Buckets shared between replicas on any Redis-compatible server
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+func NewRedisStore(address string) *RedisStore {
+	return NewRedisStoreWithClient(redis.NewClient(&redis.Options{
+		Addr: address,
+	}))
+}
+
+func NewRedisStoreWithClient(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{
+		client: client,
+	}
+}
+
+func (s *RedisStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	values, err := takeScript.Run(ctx, s.client, []string{key}, limit.Rate, limit.Burst, now.UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := values[0].(int64)
+
+	var tokens float64
+	if raw, ok := values[1].(string); ok {
+		tokens, _ = strconv.ParseFloat(raw, 64)
+	}
+
+	return result(allowed == 1, tokens, limit), nil
+}
@@ -0,0 +1,121 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker - Opens after FailureThreshold consecutive failures, lets one probe
+// through after the open period and closes again when the probe succeeds
+type Breaker struct {
+	mutex     sync.Mutex
+	name      string
+	threshold int
+	open_for  time.Duration
+	state     State
+	failures  int
+	opened_at time.Time
+	probing   bool
+}
+
+func NewBreaker(name string, threshold int, open_for time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = DefaultSettings.FailureThreshold
+	}
+	breaker := &Breaker{
+		name:      name,
+		threshold: threshold,
+		open_for:  open_for,
+	}
+	breaker.publish()
+	return breaker
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+// Allow - Returns ErrOpen while the breaker rejects calls
+func (b *Breaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.opened_at) < b.open_for {
+			return ErrOpen
+		}
+		b.transition(HalfOpen)
+		b.probing = true
+		return nil
+	case HalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *Breaker) Success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != Closed {
+		b.transition(Closed)
+	}
+}
+
+func (b *Breaker) Failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.opened_at = time.Now()
+		b.transition(Open)
+	}
+}
+
+func (b *Breaker) transition(state State) {
+	b.state = state
+	transitions.WithLabelValues(b.name, state.String()).Inc()
+	b.publish()
+}
+
+func (b *Breaker) publish() {
+	breakerState.WithLabelValues(b.name).Set(float64(b.state))
+}
@@ -0,0 +1,150 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Dependencies protected by a circuit breaker
+const (
+	DynamoDB = "dynamodb"
+	SNS      = "sns"
+	SQS      = "sqs"
+	SSM      = "ssm"
+	S3       = "s3"
+)
+
+// Settings - Retry policy and circuit breaker of one dependency
+type Settings struct {
+	MaxAttempts      int
+	BaseDelayMs      int
+	MaxDelayMs       int
+	FailureThreshold int
+	OpenSeconds      int
+}
+
+// Config - Default settings and per-dependency overrides
+type Config struct {
+	Default      Settings
+	Dependencies map[string]Settings
+}
+
+var DefaultSettings = Settings{
+	MaxAttempts:      3,
+	BaseDelayMs:      100,
+	MaxDelayMs:       2000,
+	FailureThreshold: 5,
+	OpenSeconds:      30,
+}
+
+var (
+	mutex    sync.Mutex
+	config   = Config{Default: DefaultSettings}
+	breakers = make(map[string]*Breaker)
+)
+
+// Setup - Replaces the settings; breakers are rebuilt on next use
+func Setup(c Config) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if c.Default == (Settings{}) {
+		c.Default = DefaultSettings
+	}
+	config = c
+	breakers = make(map[string]*Breaker)
+}
+
+func settings(dependency string) Settings {
+	if s, found := config.Dependencies[dependency]; found {
+		return s
+	}
+	return config.Default
+}
+
+// GetBreaker - Circuit breaker Singleton of the dependency
+func GetBreaker(dependency string) *Breaker {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	breaker, found := breakers[dependency]
+	if !found {
+		s := settings(dependency)
+		breaker = NewBreaker(dependency, s.FailureThreshold, time.Duration(s.OpenSeconds)*time.Second)
+		breakers[dependency] = breaker
+	}
+	return breaker
+}
+
+// GetPolicy - Retry policy of the dependency
+func GetPolicy(dependency string) Policy {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	s := settings(dependency)
+	return Policy{
+		MaxAttempts: s.MaxAttempts,
+		BaseDelay:   time.Duration(s.BaseDelayMs) * time.Millisecond,
+		MaxDelay:    time.Duration(s.MaxDelayMs) * time.Millisecond,
+		Retryable:   IsRetryable,
+	}
+}
+
+// States - Current state of every breaker in use, by dependency
+func States() map[string]string {
+	mutex.Lock()
+	current := make([]*Breaker, 0, len(breakers))
+	for _, breaker := range breakers {
+		current = append(current, breaker)
+	}
+	mutex.Unlock()
+
+	states := make(map[string]string, len(current))
+	for _, breaker := range current {
+		states[breaker.Name()] = breaker.State().String()
+	}
+	return states
+}
+
+// Call - Runs fn with the dependency retry policy; every attempt goes through the dependency breaker
+func Call(ctx context.Context, dependency string, fn func(ctx context.Context) error) error {
+	breaker := GetBreaker(dependency)
+	policy := GetPolicy(dependency)
+
+	return policy.Do(ctx, dependency, func(ctx context.Context) error {
+		if err := breaker.Allow(); err != nil {
+			return err
+		}
+
+		err := fn(ctx)
+		if err != nil && countsAsFailure(err) {
+			breaker.Failure()
+		} else {
+			breaker.Success()
+		}
+		return err
+	})
+}
+
+// IsRetryable - Throttling, 5xx and transport errors are retried; breaker rejections and cancellations are not
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrOpen) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return request.IsErrorThrottle(err) || request.IsErrorRetryable(err)
+}
+
+// countsAsFailure - Client errors such as a failed condition say nothing about the dependency health
+func countsAsFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	return errors.Is(err, context.DeadlineExceeded) || request.IsErrorThrottle(err) || request.IsErrorRetryable(err)
+}
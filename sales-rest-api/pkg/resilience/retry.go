@@ -0,0 +1,62 @@
+package resilience
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Policy - Exponential backoff with full jitter
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Retryable   func(error) bool
+}
+
+// Delay - Random wait in [0, min(MaxDelay, BaseDelay * 2^attempt)) before the next attempt
+func (p Policy) Delay(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+
+	ceiling := p.BaseDelay
+	for i := 0; i < attempt && (p.MaxDelay <= 0 || ceiling < p.MaxDelay); i++ {
+		ceiling *= 2
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// Do - Runs fn until it succeeds, returns a non retryable error, runs out of attempts or ctx is done
+func (p Policy) Do(ctx context.Context, dependency string, fn func(ctx context.Context) error) error {
+	attempts := p.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			retries.WithLabelValues(dependency).Inc()
+
+			timer := time.NewTimer(p.Delay(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		err = fn(ctx)
+		if err == nil || p.Retryable == nil || !p.Retryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
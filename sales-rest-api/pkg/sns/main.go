@@ -1,14 +1,76 @@
 package sns
 
 import (
+	"context"
+	"errors"
 	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/msfidelis/sales-rest-api/pkg/resilience"
 )
 
-func Publish(message string, topic_arn string) (*sns.PublishOutput, error) {
+// MaxAttributes - SNS delivers at most 10 message attributes
+const MaxAttributes = 10
+
+var ErrTooManyAttributes = errors.New("sns message exceeds 10 message attributes")
+
+// PublishOption - Customizes the SNS publish input
+type PublishOption func(input *sns.PublishInput)
+
+// WithAttributes - Sends the attributes as String message attributes
+func WithAttributes(attributes map[string]string) PublishOption {
+	return func(input *sns.PublishInput) {
+		if input.MessageAttributes == nil {
+			input.MessageAttributes = make(map[string]*sns.MessageAttributeValue)
+		}
+		for name, value := range attributes {
+			input.MessageAttributes[name] = &sns.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(value),
+			}
+		}
+	}
+}
+
+// WithFIFO - Sets the group and deduplication ids required by FIFO topics
+func WithFIFO(group_id string, deduplication_id string) PublishOption {
+	return func(input *sns.PublishInput) {
+		input.MessageGroupId = aws.String(group_id)
+		input.MessageDeduplicationId = aws.String(deduplication_id)
+	}
+}
+
+// IsFIFO - FIFO topic names end with .fifo
+func IsFIFO(topic_arn string) bool {
+	return strings.HasSuffix(topic_arn, ".fifo")
+}
+
+// NewPublishInput - Builds the publish input of the message to the topic with the options applied; fails past MaxAttributes
+func NewPublishInput(message string, topic_arn string, options ...PublishOption) (*sns.PublishInput, error) {
+	input := &sns.PublishInput{
+		Message:  aws.String(message),
+		TopicArn: aws.String(topic_arn),
+	}
+
+	for _, option := range options {
+		option(input)
+	}
+
+	if len(input.MessageAttributes) > MaxAttributes {
+		return nil, ErrTooManyAttributes
+	}
+	return input, nil
+}
+
+func Publish(message string, topic_arn string, options ...PublishOption) (*sns.PublishOutput, error) {
+	return PublishWithContext(context.Background(), message, topic_arn, options...)
+}
+
+// PublishWithContext - Publishes the message; ctx bounds the retries and the in-flight request
+func PublishWithContext(ctx context.Context, message string, topic_arn string, options ...PublishOption) (*sns.PublishOutput, error) {
 
 	sess, err := session.NewSession(&aws.Config{
 		Region: aws.String(os.Getenv("AWS_REGION")),
@@ -20,9 +82,15 @@ func Publish(message string, topic_arn string) (*sns.PublishOutput, error) {
 
 	svc := sns.New(sess)
 
-	result, err := svc.Publish(&sns.PublishInput{
-		Message:  aws.String(message),
-		TopicArn: aws.String(topic_arn),
+	input, err := NewPublishInput(message, topic_arn, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *sns.PublishOutput
+	err = resilience.Call(ctx, resilience.SNS, func(ctx context.Context) error {
+		result, err = svc.PublishWithContext(ctx, input)
+		return err
 	})
 
 	return result, err
@@ -0,0 +1,97 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/msfidelis/sales-rest-api/pkg/resilience"
+)
+
+// MaxAttributes - SQS accepts at most 10 message attributes
+const MaxAttributes = 10
+
+var ErrTooManyAttributes = errors.New("sqs message exceeds 10 message attributes")
+
+// SendOption - Customizes the SQS send input
+type SendOption func(input *sqs.SendMessageInput)
+
+// WithAttributes - Sends the attributes as String message attributes
+func WithAttributes(attributes map[string]string) SendOption {
+	return func(input *sqs.SendMessageInput) {
+		if input.MessageAttributes == nil {
+			input.MessageAttributes = make(map[string]*sqs.MessageAttributeValue)
+		}
+		for name, value := range attributes {
+			input.MessageAttributes[name] = &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(value),
+			}
+		}
+	}
+}
+
+// WithFIFO - Sets the group and deduplication ids required by FIFO queues
+func WithFIFO(group_id string, deduplication_id string) SendOption {
+	return func(input *sqs.SendMessageInput) {
+		input.MessageGroupId = aws.String(group_id)
+		input.MessageDeduplicationId = aws.String(deduplication_id)
+	}
+}
+
+// IsFIFO - FIFO queue names end with .fifo
+func IsFIFO(queue_url string) bool {
+	return strings.HasSuffix(queue_url, ".fifo")
+}
+
+// NewSendInput - Builds the send input of the message to the queue with the options applied; fails past MaxAttributes
+func NewSendInput(message string, queue_url string, options ...SendOption) (*sqs.SendMessageInput, error) {
+	input := &sqs.SendMessageInput{
+		MessageBody: aws.String(message),
+		QueueUrl:    aws.String(queue_url),
+	}
+
+	for _, option := range options {
+		option(input)
+	}
+
+	if len(input.MessageAttributes) > MaxAttributes {
+		return nil, ErrTooManyAttributes
+	}
+	return input, nil
+}
+
+func Send(message string, queue_url string, options ...SendOption) (*sqs.SendMessageOutput, error) {
+	return SendWithContext(context.Background(), message, queue_url, options...)
+}
+
+// SendWithContext - Sends the message; ctx bounds the retries and the in-flight request
+func SendWithContext(ctx context.Context, message string, queue_url string, options ...SendOption) (*sqs.SendMessageOutput, error) {
+
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(os.Getenv("AWS_REGION")),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	svc := sqs.New(sess)
+
+	input, err := NewSendInput(message, queue_url, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *sqs.SendMessageOutput
+	err = resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		result, err = svc.SendMessageWithContext(ctx, input)
+		return err
+	})
+
+	return result, err
+}
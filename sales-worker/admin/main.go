@@ -0,0 +1,292 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"sales-worker/listeners/sales_update"
+	"sales-worker/pkg/auth"
+	"sales-worker/pkg/autoscaler"
+	"sales-worker/pkg/log"
+	"sales-worker/pkg/resilience"
+	"sales-worker/pkg/slo"
+	"sales-worker/pkg/supervisor"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// BuildInfo - Version and build metadata injected at link time
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Options - Dependencies of the admin API
+type Options struct {
+	Authenticator *auth.Authenticator
+	Scaler        *autoscaler.Autoscaler
+	// Stop - Lifetime of the consumers started by thread count changes
+	Stop context.Context
+	// LivenessWindow - Longest time without progress of any consumer thread before /liveness fails
+	LivenessWindow time.Duration
+	Build          BuildInfo
+}
+
+type server struct {
+	options Options
+}
+
+// New - Admin API of the worker; probes, metrics and /version are public and the runtime
+// controls require the admin:site scope, as the REST API admin routes
+func New(options Options) *http.ServeMux {
+	s := &server{options: options}
+	s.options.Build.GoVersion = runtime.Version()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthcheck", s.healthcheck)
+	mux.HandleFunc("/liveness", s.liveness)
+	mux.HandleFunc("/readiness", s.readiness)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/version", s.version)
+	mux.HandleFunc("/slo", s.slo)
+
+	mux.Handle("/status", s.authorize(http.HandlerFunc(s.status)))
+	mux.Handle("/pause", s.authorize(http.HandlerFunc(s.pause)))
+	mux.Handle("/resume", s.authorize(http.HandlerFunc(s.resume)))
+	mux.Handle("/threads", s.authorize(http.HandlerFunc(s.threads)))
+	mux.Handle("/admin/log-level", s.authorize(http.HandlerFunc(s.logLevel)))
+
+	return mux
+}
+
+// authorize - Authenticates the request and requires the admin:site scope
+func (s *server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := log.FromContext(r.Context())
+
+		principal, err := s.options.Authenticator.Authenticate(r)
+		if err != nil {
+			logger.Warn().
+				Str("Action", "auth").
+				Str("Path", r.URL.Path).
+				Str("Error", err.Error()).
+				Msg("Request not authenticated")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sales"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		}
+
+		logger = logger.With().
+			Str("Principal", principal.Subject).
+			Str("AuthMethod", principal.Method).
+			Logger()
+
+		if s.options.Authenticator.Enabled() && !principal.HasScope(auth.ScopeAdminSite) {
+			logger.Warn().
+				Str("Action", "auth").
+				Str("Scope", auth.ScopeAdminSite).
+				Msg("Principal missing required scope")
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "insufficient scope"})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(log.WithContext(r.Context(), logger)))
+	})
+}
+
+func (s *server) healthcheck(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "OK")
+}
+
+// liveness - Fails when no consumer thread made progress within the window, e.g. deadlocked
+// consumers, so the orchestrator restarts the container
+func (s *server) liveness(w http.ResponseWriter, r *http.Request) {
+	alive, age := supervisor.Alive(s.options.LivenessWindow)
+
+	heartbeats := make(map[string]time.Time)
+	for thread, beat := range supervisor.Heartbeats() {
+		heartbeats[strconv.Itoa(thread)] = beat
+	}
+
+	status := "Alive"
+	code := http.StatusOK
+	if !alive {
+		status = "NotAlive"
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, map[string]interface{}{
+		"status":                status,
+		"last_progress_seconds": age.Seconds(),
+		"window_seconds":        s.options.LivenessWindow.Seconds(),
+		"heartbeats":            heartbeats,
+	})
+}
+
+// readiness - Not ready while a circuit breaker of an AWS dependency is open
+func (s *server) readiness(w http.ResponseWriter, r *http.Request) {
+	status := "Ready"
+	dependencies := resilience.States()
+	for _, state := range dependencies {
+		if state == resilience.Open.String() {
+			status = "NotReady"
+		}
+	}
+
+	code := http.StatusOK
+	if status != "Ready" {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, map[string]interface{}{
+		"status":       status,
+		"dependencies": dependencies,
+	})
+}
+
+func (s *server) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.options.Build)
+}
+
+// slo - Last evaluation of the end-to-end latency objective; 503 while it is breaching so
+// failover automation can poll it as a probe
+func (s *server) slo(w http.ResponseWriter, r *http.Request) {
+	status := slo.Last()
+
+	code := http.StatusOK
+	if status.Breaching {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+// status - Consumer threads, pause flag and the last known site state
+func (s *server) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	min_threads, max_threads := s.options.Scaler.Bounds()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"site_state":  log.State(),
+		"paused":      sales_update.Paused(),
+		"passive":     sales_update.PassiveMode(),
+		"min_threads": min_threads,
+		"max_threads": max_threads,
+		"threads":     sales_update.Statuses(),
+	})
+}
+
+func (s *server) pause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sales_update.Pause()
+
+	logger := log.FromContext(r.Context())
+	logger.Warn().
+		Str("Action", "admin").
+		Msg("Consumption paused")
+
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+func (s *server) resume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sales_update.Resume()
+
+	logger := log.FromContext(r.Context())
+	logger.Info().
+		Str("Action", "admin").
+		Msg("Consumption resumed")
+
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+}
+
+// threads - GET returns the thread bounds; PUT {"threads": n} fixes the count and
+// {"min": a, "max": b} sets the autoscaling range
+func (s *server) threads(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var request struct {
+			Threads int `json:"threads"`
+			Min     int `json:"min"`
+			Max     int `json:"max"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if request.Threads > 0 {
+			request.Min, request.Max = request.Threads, request.Threads
+		}
+		if err := s.options.Scaler.Resize(s.options.Stop, request.Min, request.Max); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		logger := log.FromContext(r.Context())
+		logger.Warn().
+			Str("Action", "admin").
+			Int("Min", request.Min).
+			Int("Max", request.Max).
+			Msg("Consumer thread bounds changed")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	min_threads, max_threads := s.options.Scaler.Bounds()
+	writeJSON(w, http.StatusOK, map[string]int{
+		"threads": s.options.Scaler.Threads(),
+		"min":     min_threads,
+		"max":     max_threads,
+	})
+}
+
+func (s *server) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var request struct {
+			Level string `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := log.SetLevel(request.Level); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"level": log.GetLevel()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
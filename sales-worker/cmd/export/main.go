@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"sales-worker/pkg/archive"
+	"sales-worker/pkg/export"
+	"sales-worker/pkg/log"
+)
+
+// Exports the sales archive to Parquet:
+//
+//	export -from 2024-01-01 -to 2024-01-31 -source s3://sales-bucket
+//	export -source ./archive -destination ./parquet
+//
+// Locations starting with s3:// are buckets, any other is a local directory
+func main() {
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+
+	from := flag.String("from", yesterday, "first UTC day exported, YYYY-MM-DD")
+	to := flag.String("to", "", "last UTC day exported, YYYY-MM-DD; defaults to -from")
+	source := flag.String("source", "s3://"+os.Getenv("S3_SALES_BUCKET"), "archive location")
+	destination := flag.String("destination", "", "output location; defaults to -source")
+	archive_prefix := flag.String("archive-prefix", "sales", "prefix of the archived sales")
+	output_prefix := flag.String("output-prefix", "exports/parquet", "prefix of the Parquet files and manifest")
+	region := flag.String("region", os.Getenv("AWS_REGION"), "region of the legacy per-sale objects")
+	flag.Parse()
+
+	log := log.Setup(log.Config{
+		Service: "sales-export",
+		Region:  os.Getenv("AWS_REGION"),
+		Level:   os.Getenv("LOG_LEVEL"),
+		Format:  os.Getenv("LOG_FORMAT"),
+	})
+
+	if *to == "" {
+		*to = *from
+	}
+	if *destination == "" {
+		*destination = *source
+	}
+
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -from: %s\n", err)
+		os.Exit(2)
+	}
+	end, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -to: %s\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	manifest, err := export.Run(ctx, export.Config{
+		Source:        archive.OpenStorage(*source),
+		Destination:   archive.OpenStorage(*destination),
+		ArchivePrefix: *archive_prefix,
+		OutputPrefix:  *output_prefix,
+		Region:        *region,
+	}, start, end)
+	if err != nil {
+		log.Error().
+			Str("Action", "export").
+			Str("Error", err.Error()).
+			Msg("Error to export sales to Parquet")
+		os.Exit(1)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(manifest)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"sales-worker/models/sales_model"
+	"sales-worker/pkg/archive"
+	"sales-worker/pkg/log"
+	"sales-worker/pkg/restore"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Rebuilds DYNAMO_SALES_TABLE and DYNAMO_SALES_IDEMPOTENCY_TABLE from the sales archive:
+//
+//	restore -from 2024-01-01 -to 2024-01-31 -rate 200
+//
+// Rerunning the same range resumes from its checkpoint file
+func main() {
+	from := flag.String("from", "", "first UTC day restored, YYYY-MM-DD")
+	to := flag.String("to", "", "last UTC day restored, YYYY-MM-DD; defaults to -from")
+	source := flag.String("source", "s3://"+os.Getenv("S3_SALES_BUCKET"), "archive location; s3://bucket or a local directory")
+	archive_prefix := flag.String("archive-prefix", "sales", "prefix of the archived sales")
+	region := flag.String("region", os.Getenv("AWS_REGION"), "region of the legacy per-sale objects")
+	checkpoint := flag.String("checkpoint", "", "checkpoint file; defaults to restore-<from>_<to>.json")
+	rate := flag.Float64("rate", 100, "items written per second, one write call each; 0 doesn't throttle")
+	ttl_hours := flag.Int("idempotency-ttl-hours", idempotencyTTLHours(), "TTL of the rebuilt idempotency records; 0 skips the idempotency table")
+	flag.Parse()
+
+	log := log.Setup(log.Config{
+		Service: "sales-restore",
+		Region:  os.Getenv("AWS_REGION"),
+		Level:   os.Getenv("LOG_LEVEL"),
+		Format:  os.Getenv("LOG_FORMAT"),
+	})
+
+	if *from == "" {
+		fmt.Fprintln(os.Stderr, "-from is required")
+		os.Exit(2)
+	}
+	if *to == "" {
+		*to = *from
+	}
+	if *checkpoint == "" {
+		*checkpoint = fmt.Sprintf("restore-%s_%s.json", *from, *to)
+	}
+
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -from: %s\n", err)
+		os.Exit(2)
+	}
+	end, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -to: %s\n", err)
+		os.Exit(2)
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(os.Getenv("AWS_REGION")),
+	})
+	if err != nil {
+		log.Error().
+			Str("Action", "restore").
+			Str("Error", err.Error()).
+			Msg("Error to create AWS Session")
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	result, err := restore.Run(ctx, sales_model.NewModelDAO(dynamodb.New(sess)), restore.Config{
+		Source:         archive.OpenStorage(*source),
+		ArchivePrefix:  *archive_prefix,
+		Region:         *region,
+		Checkpoint:     *checkpoint,
+		Rate:           *rate,
+		IdempotencyTTL: time.Duration(*ttl_hours) * time.Hour,
+	}, start, end)
+	if err != nil {
+		log.Error().
+			Str("Action", "restore").
+			Str("Checkpoint", *checkpoint).
+			Str("Error", err.Error()).
+			Msg("Restore interrupted; rerun the same range to resume")
+		os.Exit(1)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+}
+
+// idempotencyTTLHours - IDEMPOTENCY_TTL_HOURS as the worker, 7 days by default
+func idempotencyTTLHours() int {
+	hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		return 7 * 24
+	}
+	return hours
+}
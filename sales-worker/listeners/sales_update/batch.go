@@ -0,0 +1,296 @@
+package sales_update
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"sales-worker/pkg/failure"
+	"sales-worker/pkg/log"
+	"sales-worker/pkg/resilience"
+	"sales-worker/pkg/slo"
+	"sales-worker/pkg/supervisor"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	defaultConcurrency = 5
+	defaultPrefetch    = 10
+
+	// maxBatchSize - SQS receives and deletes at most 10 messages per call
+	maxBatchSize = 10
+)
+
+// processBatch - Processes the received messages with at most CONSUMER_CONCURRENCY at a time
+// and acknowledges each successful one as soon as it finishes, so a slow message doesn't keep
+// finished ones past their visibility timeout. A processed message frees its slot while it
+// waits for its beforeAck work, like the upload of its archive part, under its heartbeat;
+// returns the messages processed and failed
+func processBatch(ctx context.Context, stop context.Context, sqsClient *sqs.SQS, queueURL string, messages []*sqs.Message, site_state string, visibility time.Duration, received_at time.Time) (int, int) {
+	log := log.FromContext(ctx)
+	deadline := processingDeadline(visibilityExtensionCap(visibility))
+
+	var (
+		mutex     sync.Mutex
+		group     sync.WaitGroup
+		released  []*sqs.Message
+		processed int
+		failed    int
+	)
+
+	slots := make(chan struct{}, concurrency())
+
+	acks := make(chan *sqs.Message, len(messages))
+	acked := make(chan struct{})
+	go func() {
+		defer close(acked)
+		acknowledge(ctx, sqsClient, queueURL, acks)
+	}()
+
+	for _, msg := range messages {
+		observeQueueWait(msg, received_at)
+	}
+
+	for _, msg := range messages {
+		slots <- struct{}{}
+
+		// Shutting down: messages not started yet go back to the queue unprocessed
+		if stop.Err() != nil {
+			<-slots
+			released = append(released, msg)
+			continue
+		}
+
+		group.Add(1)
+		go func(msg *sqs.Message) {
+			defer group.Done()
+			var free sync.Once
+			defer free.Do(func() { <-slots })
+
+			log.Info().
+				Str("Action", "consume").
+				Str("MessageId", aws.StringValue(msg.MessageId)).
+				Str("Body", aws.StringValue(msg.Body)).
+				Msg("Message")
+
+			msg_ctx, cancel := context.WithDeadline(ctx, received_at.Add(deadline))
+			msg_ctx, hooks := withAckHooks(msg_ctx)
+			stopHeartbeat := startHeartbeat(msg_ctx, cancel, sqsClient, queueURL, msg, visibility, received_at)
+			started := time.Now()
+			err := safeProcessMessage(msg_ctx, msg, site_state)
+			elapsed := time.Since(started).Seconds()
+			if err == nil {
+				free.Do(func() { <-slots })
+				err = hooks.run(msg_ctx)
+			}
+			supervisor.Beat(ctx)
+			stopHeartbeat()
+			cancel()
+
+			switch {
+			// Grace period expired mid-processing; the delete can't run anymore, so the
+			// message is released and idempotency covers the redelivery
+			case ctx.Err() != nil:
+				mutex.Lock()
+				released = append(released, msg)
+				mutex.Unlock()
+				processingDuration.WithLabelValues("released").Observe(elapsed)
+			case errors.Is(err, ErrSiteNotActive):
+				handlePassive(ctx, sqsClient, queueURL, msg)
+			case err == nil:
+				mutex.Lock()
+				processed++
+				mutex.Unlock()
+				acks <- msg
+				processingDuration.WithLabelValues("success").Observe(elapsed)
+			default:
+				log.Error().
+					Str("Action", "consume").
+					Str("Error", err.Error()).
+					Str("MessageId", aws.StringValue(msg.MessageId)).
+					Msg("Error process sale")
+				processingDuration.WithLabelValues("failure").Observe(elapsed)
+				slo.RecordFailure()
+				handleFailure(ctx, sqsClient, queueURL, msg, err)
+				mutex.Lock()
+				failed++
+				mutex.Unlock()
+			}
+		}(msg)
+	}
+
+	group.Wait()
+	close(acks)
+
+	if len(released) > 0 {
+		releaseMessages(ctx, sqsClient, queueURL, released)
+	}
+
+	<-acked
+
+	return processed, failed
+}
+
+// ackHooks - Work a processed message waits for before it is acked
+type ackHooks struct {
+	mutex sync.Mutex
+	hooks []func(ctx context.Context) error
+}
+
+type ackHooksKey struct{}
+
+// withAckHooks - Context collecting the beforeAck work of one message
+func withAckHooks(ctx context.Context) (context.Context, *ackHooks) {
+	hooks := &ackHooks{}
+	return context.WithValue(ctx, ackHooksKey{}, hooks), hooks
+}
+
+// beforeAck - Defers hook until the message is processed and about to be acked, outside its
+// concurrency slot; runs it right away when the message is processed outside processBatch
+func beforeAck(ctx context.Context, hook func(ctx context.Context) error) error {
+	hooks, found := ctx.Value(ackHooksKey{}).(*ackHooks)
+	if !found {
+		return hook(ctx)
+	}
+
+	hooks.mutex.Lock()
+	defer hooks.mutex.Unlock()
+	hooks.hooks = append(hooks.hooks, hook)
+	return nil
+}
+
+// run - Runs the hooks in order; the first error fails the message
+func (h *ackHooks) run(ctx context.Context) error {
+	h.mutex.Lock()
+	hooks := h.hooks
+	h.hooks = nil
+	h.mutex.Unlock()
+
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acknowledge - Deletes the processed messages while the rest of the batch is still running;
+// messages finished during a delete are coalesced into the next DeleteMessageBatch
+func acknowledge(ctx context.Context, sqsClient *sqs.SQS, queueURL string, acks <-chan *sqs.Message) {
+	for msg := range acks {
+		pending := []*sqs.Message{msg}
+
+	drain:
+		for len(pending) < maxBatchSize {
+			select {
+			case msg, ok := <-acks:
+				if !ok {
+					break drain
+				}
+				pending = append(pending, msg)
+			default:
+				break drain
+			}
+		}
+
+		deleteMessages(ctx, sqsClient, queueURL, pending)
+	}
+}
+
+// safeProcessMessage - A panic while processing one message fails that message as retryable
+// instead of crashing the process; the supervisor can't recover panics of this goroutine
+func safeProcessMessage(ctx context.Context, msg *sqs.Message, site_state string) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger := log.FromContext(ctx)
+			logger.Error().
+				Str("Action", "consume").
+				Str("MessageId", aws.StringValue(msg.MessageId)).
+				Str("Panic", fmt.Sprint(recovered)).
+				Str("Stack", string(debug.Stack())).
+				Msg("Panic while processing message")
+			err = failure.NewRetryable(fmt.Errorf("panic: %v", recovered))
+		}
+	}()
+
+	return processMessage(ctx, msg, site_state)
+}
+
+// deleteMessages - Acknowledges the messages with DeleteMessageBatch; failed entries are
+// redelivered after the visibility timeout and skipped by the idempotency check
+func deleteMessages(ctx context.Context, sqsClient *sqs.SQS, queueURL string, messages []*sqs.Message) {
+	log := log.FromContext(ctx)
+
+	entries := make([]*sqs.DeleteMessageBatchRequestEntry, 0, len(messages))
+	for i, msg := range messages {
+		entries = append(entries, &sqs.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+	}
+
+	var result *sqs.DeleteMessageBatchOutput
+	err := resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		var err error
+		result, err = sqsClient.DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		return err
+	})
+
+	if err != nil {
+		log.Error().
+			Str("Action", "consume").
+			Int("Messages", len(messages)).
+			Str("Error", err.Error()).
+			Msg("Error to delete Messages from Queue")
+		return
+	}
+
+	for _, failed := range result.Failed {
+		index, _ := strconv.Atoi(aws.StringValue(failed.Id))
+		log.Error().
+			Str("Action", "consume").
+			Str("MessageId", aws.StringValue(messages[index].MessageId)).
+			Str("Code", aws.StringValue(failed.Code)).
+			Str("Error", aws.StringValue(failed.Message)).
+			Bool("SenderFault", aws.BoolValue(failed.SenderFault)).
+			Msg("Error to delete Message from Queue")
+	}
+
+	for _, successful := range result.Successful {
+		index, _ := strconv.Atoi(aws.StringValue(successful.Id))
+		log.Info().
+			Str("MessageId", aws.StringValue(messages[index].MessageId)).
+			Msg("Message removed from queue")
+	}
+}
+
+// concurrency - CONSUMER_CONCURRENCY; messages of a batch processed at the same time
+func concurrency() int {
+	value, err := strconv.Atoi(os.Getenv("CONSUMER_CONCURRENCY"))
+	if err != nil || value <= 0 {
+		return defaultConcurrency
+	}
+	return value
+}
+
+// prefetch - CONSUMER_PREFETCH; messages requested per ReceiveMessage, from 1 to 10
+func prefetch() int64 {
+	value, err := strconv.Atoi(os.Getenv("CONSUMER_PREFETCH"))
+	if err != nil || value <= 0 {
+		return defaultPrefetch
+	}
+	if value > maxBatchSize {
+		return maxBatchSize
+	}
+	return int64(value)
+}
@@ -0,0 +1,206 @@
+package sales_update
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// fakeSQS - Records the calls received; answers DeleteMessageBatch with every entry deleted
+type fakeSQS struct {
+	mutex   sync.Mutex
+	calls   []url.Values
+	batches []int
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	f.mutex.Lock()
+	f.calls = append(f.calls, r.PostForm)
+	f.mutex.Unlock()
+
+	action := r.PostForm.Get("Action")
+	if action == "SendMessage" {
+		// The SDK checks the digest of the body it sent
+		fmt.Fprintf(w, "<SendMessageResponse><SendMessageResult><MessageId>copy</MessageId><MD5OfMessageBody>%x</MD5OfMessageBody></SendMessageResult></SendMessageResponse>", md5.Sum([]byte(r.PostForm.Get("MessageBody"))))
+		return
+	}
+	if action != "DeleteMessageBatch" {
+		fmt.Fprintf(w, "<%sResponse><%sResult></%sResult></%sResponse>", action, action, action, action)
+		return
+	}
+
+	var entries []string
+	for key, values := range r.PostForm {
+		if strings.HasPrefix(key, "DeleteMessageBatchRequestEntry.") && strings.HasSuffix(key, ".Id") {
+			entries = append(entries, values[0])
+		}
+	}
+
+	f.mutex.Lock()
+	f.batches = append(f.batches, len(entries))
+	f.mutex.Unlock()
+
+	var results strings.Builder
+	for _, id := range entries {
+		fmt.Fprintf(&results, "<DeleteMessageBatchResultEntry><Id>%s</Id></DeleteMessageBatchResultEntry>", id)
+	}
+	fmt.Fprintf(w, "<DeleteMessageBatchResponse><DeleteMessageBatchResult>%s</DeleteMessageBatchResult></DeleteMessageBatchResponse>", results.String())
+}
+
+// actions - Actions of the calls received, in order
+func (f *fakeSQS) actions() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	actions := make([]string, 0, len(f.calls))
+	for _, call := range f.calls {
+		actions = append(actions, call.Get("Action"))
+	}
+	return actions
+}
+
+func newFakeSQS(t *testing.T) (*fakeSQS, *sqs.SQS) {
+	fake := &fakeSQS{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	return fake, sqs.New(sess)
+}
+
+func TestAcknowledge(t *testing.T) {
+
+	tests := map[string]struct {
+		messages int
+		want     []int
+	}{
+		"Single Message":          {1, []int{1}},
+		"Finished Together":       {4, []int{4}},
+		"More Than A Batch Holds": {12, []int{10, 2}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, client := newFakeSQS(t)
+
+			acks := make(chan *sqs.Message, test.messages)
+			for i := 0; i < test.messages; i++ {
+				acks <- &sqs.Message{
+					MessageId:     aws.String(strconv.Itoa(i)),
+					ReceiptHandle: aws.String("receipt-" + strconv.Itoa(i)),
+				}
+			}
+			close(acks)
+
+			acknowledge(context.Background(), client, "https://sqs.us-east-1.amazonaws.com/0/sales", acks)
+
+			if fmt.Sprint(fake.batches) != fmt.Sprint(test.want) {
+				t.Errorf("got batches %v want %v", fake.batches, test.want)
+			}
+		})
+	}
+
+	t.Run("Deletes Before The Batch Ends", func(t *testing.T) {
+		fake, client := newFakeSQS(t)
+
+		acks := make(chan *sqs.Message)
+		acked := make(chan struct{})
+		go func() {
+			defer close(acked)
+			acknowledge(context.Background(), client, "https://sqs.us-east-1.amazonaws.com/0/sales", acks)
+		}()
+
+		acks <- &sqs.Message{MessageId: aws.String("fast"), ReceiptHandle: aws.String("receipt-fast")}
+
+		// The channel stays open, as while a slow message is still running
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			fake.mutex.Lock()
+			deleted := len(fake.batches)
+			fake.mutex.Unlock()
+			if deleted == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("finished message not deleted while the batch was running")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		close(acks)
+		<-acked
+	})
+
+}
+
+func TestAckHooks(t *testing.T) {
+
+	t.Run("Runs Right Away Outside A Batch", func(t *testing.T) {
+		ran := false
+		err := beforeAck(context.Background(), func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+		if err != nil || !ran {
+			t.Errorf("got ran %v err %v want the hook run", ran, err)
+		}
+	})
+
+	t.Run("Deferred Until The Ack", func(t *testing.T) {
+		ctx, hooks := withAckHooks(context.Background())
+
+		var ran []string
+		for _, name := range []string{"archive", "complete"} {
+			name := name
+			beforeAck(ctx, func(ctx context.Context) error {
+				ran = append(ran, name)
+				return nil
+			})
+		}
+		if len(ran) != 0 {
+			t.Fatalf("hooks ran before the ack: %v", ran)
+		}
+
+		if err := hooks.run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(ran) != "[archive complete]" {
+			t.Errorf("got %v", ran)
+		}
+	})
+
+	t.Run("First Error Fails The Message", func(t *testing.T) {
+		ctx, hooks := withAckHooks(context.Background())
+		failed := errors.New("part dropped")
+
+		ran := 0
+		beforeAck(ctx, func(ctx context.Context) error { ran++; return failed })
+		beforeAck(ctx, func(ctx context.Context) error { ran++; return nil })
+
+		if err := hooks.run(ctx); !errors.Is(err, failed) || ran != 1 {
+			t.Errorf("got %v after %d hooks want %v after 1", err, ran, failed)
+		}
+	})
+
+}
@@ -0,0 +1,178 @@
+package sales_update
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"sales-worker/pkg/dead_letter"
+	"sales-worker/pkg/failure"
+	"sales-worker/pkg/log"
+	"sales-worker/pkg/resilience"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	// defaultMaxReceiveCount - Deliveries before a retryable message is dead-lettered
+	defaultMaxReceiveCount = 5
+
+	// defaultMaxNotReplicatedReceiveCount - Deliveries of a sale missing from this region; about
+	// 25 minutes of backoff, to outlast the cross-region replication lag of a failover
+	defaultMaxNotReplicatedReceiveCount = 30
+)
+
+// retryBackoff - Visibility delay of the first redelivery and its cap, by error kind
+var retryBackoff = map[failure.Kind][2]time.Duration{
+	failure.Retryable:     {5 * time.Second, 15 * time.Minute},
+	failure.NotReplicated: {2 * time.Second, time.Minute},
+}
+
+// handleFailure - Dead-letters permanent errors and messages past the receive budget of their
+// kind; delays the redelivery of the others through the message visibility
+func handleFailure(ctx context.Context, sqsClient *sqs.SQS, queueURL string, msg *sqs.Message, err error) {
+	log := log.FromContext(ctx)
+
+	kind := failure.Classify(err)
+	receive_count := receiveCount(msg)
+	id := aws.StringValue(msg.MessageId)
+
+	if kind == failure.Permanent || receive_count >= receiveBudget(kind) {
+		log.Error().
+			Str("Action", "dead-letter").
+			Str("MessageId", id).
+			Str("ErrorKind", kind.String()).
+			Int("ReceiveCount", receive_count).
+			Str("Error", err.Error()).
+			Msg("Message failed permanently")
+		deadLetter(ctx, sqsClient, queueURL, msg, kind, receive_count, err)
+		return
+	}
+
+	delay := retryDelay(kind, receive_count)
+
+	log.Warn().
+		Str("Action", "retry").
+		Str("MessageId", id).
+		Str("ErrorKind", kind.String()).
+		Int("ReceiveCount", receive_count).
+		Dur("Backoff", delay).
+		Str("Error", err.Error()).
+		Msg("Message will be redelivered")
+
+	err = resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		_, err := sqsClient.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(queueURL),
+			ReceiptHandle:     msg.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(int64(delay.Seconds())),
+		})
+		return err
+	})
+	if err != nil {
+		log.Error().
+			Str("Action", "retry").
+			Str("MessageId", id).
+			Str("Error", err.Error()).
+			Msg("Error to change message visibility; redelivery follows the queue visibility timeout")
+	}
+}
+
+func deadLetter(ctx context.Context, sqsClient *sqs.SQS, queueURL string, msg *sqs.Message, kind failure.Kind, receive_count int, cause error) {
+	log := log.FromContext(ctx)
+	id := aws.StringValue(msg.MessageId)
+
+	attributes := make(map[string]string, len(msg.MessageAttributes))
+	for name, attribute := range msg.MessageAttributes {
+		attributes[name] = aws.StringValue(attribute.StringValue)
+	}
+
+	err := dead_letter.Send(ctx, dead_letter.Record{
+		MessageId:    id,
+		Body:         aws.StringValue(msg.Body),
+		Attributes:   attributes,
+		SourceQueue:  queueURL,
+		Error:        cause.Error(),
+		ErrorKind:    kind.String(),
+		ReceiveCount: receive_count,
+	})
+
+	if errors.Is(err, dead_letter.ErrNotConfigured) {
+		// Left on the queue; its redrive policy moves it once maxReceiveCount is reached
+		log.Warn().
+			Str("Action", "dead-letter").
+			Str("MessageId", id).
+			Msg("No dead-letter destination configured; message left on the queue")
+		return
+	}
+	if err != nil {
+		log.Error().
+			Str("Action", "dead-letter").
+			Str("MessageId", id).
+			Str("Error", err.Error()).
+			Msg("Error to dead-letter message; it will be redelivered")
+		return
+	}
+
+	err = resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		_, err := sqsClient.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(queueURL),
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+		return err
+	})
+	if err != nil {
+		log.Error().
+			Str("Action", "dead-letter").
+			Str("MessageId", id).
+			Str("Error", err.Error()).
+			Msg("Error to delete dead-lettered message from Queue")
+		return
+	}
+
+	log.Info().
+		Str("Action", "dead-letter").
+		Str("MessageId", id).
+		Msg("Message moved to dead-letter destination")
+}
+
+// retryDelay - Doubles the base delay of the kind for every previous delivery, up to its cap
+func retryDelay(kind failure.Kind, receive_count int) time.Duration {
+	backoff := retryBackoff[kind]
+	delay := backoff[0]
+	for i := 1; i < receive_count && delay < backoff[1]; i++ {
+		delay *= 2
+	}
+	if delay > backoff[1] {
+		delay = backoff[1]
+	}
+	return delay
+}
+
+func receiveCount(msg *sqs.Message) int {
+	count, err := strconv.Atoi(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+	if err != nil {
+		return 1
+	}
+	return count
+}
+
+// receiveBudget - Deliveries allowed before dead-lettering: MAX_NOT_REPLICATED_RECEIVE_COUNT for
+// sales still replicating, MAX_RECEIVE_COUNT for the others. Keep both below the redrive policy
+// of the queue
+func receiveBudget(kind failure.Kind) int {
+	if kind == failure.NotReplicated {
+		return envCount("MAX_NOT_REPLICATED_RECEIVE_COUNT", defaultMaxNotReplicatedReceiveCount)
+	}
+	return envCount("MAX_RECEIVE_COUNT", defaultMaxReceiveCount)
+}
+
+func envCount(variable string, fallback int) int {
+	count, err := strconv.Atoi(os.Getenv(variable))
+	if err != nil || count <= 0 {
+		return fallback
+	}
+	return count
+}
@@ -0,0 +1,66 @@
+package sales_update
+
+import (
+	"testing"
+	"time"
+
+	"sales-worker/pkg/failure"
+)
+
+func TestRetryDelay(t *testing.T) {
+
+	tests := map[string]struct {
+		kind          failure.Kind
+		receive_count int
+		want          time.Duration
+	}{
+		"Retryable First Delivery":      {failure.Retryable, 1, 5 * time.Second},
+		"Retryable Third Delivery":      {failure.Retryable, 3, 20 * time.Second},
+		"Retryable Capped":              {failure.Retryable, 20, 15 * time.Minute},
+		"Not Replicated First Delivery": {failure.NotReplicated, 1, 2 * time.Second},
+		"Not Replicated Capped":         {failure.NotReplicated, 10, time.Minute},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := retryDelay(test.kind, test.receive_count); got != test.want {
+				t.Errorf("got %s want %s", got, test.want)
+			}
+		})
+	}
+
+}
+
+func TestReceiveBudget(t *testing.T) {
+
+	t.Run("Defaults", func(t *testing.T) {
+		if got := receiveBudget(failure.Retryable); got != defaultMaxReceiveCount {
+			t.Errorf("got %d want %d", got, defaultMaxReceiveCount)
+		}
+		if got := receiveBudget(failure.NotReplicated); got != defaultMaxNotReplicatedReceiveCount {
+			t.Errorf("got %d want %d", got, defaultMaxNotReplicatedReceiveCount)
+		}
+	})
+
+	t.Run("Not Replicated Outlasts Replication Lag", func(t *testing.T) {
+		var waited time.Duration
+		for count := 1; count < receiveBudget(failure.NotReplicated); count++ {
+			waited += retryDelay(failure.NotReplicated, count)
+		}
+		if waited < 15*time.Minute {
+			t.Errorf("not-replicated sales dead-lettered after %s", waited)
+		}
+	})
+
+	t.Run("From Environment", func(t *testing.T) {
+		t.Setenv("MAX_RECEIVE_COUNT", "3")
+		t.Setenv("MAX_NOT_REPLICATED_RECEIVE_COUNT", "50")
+		if got := receiveBudget(failure.Retryable); got != 3 {
+			t.Errorf("got %d want 3", got)
+		}
+		if got := receiveBudget(failure.NotReplicated); got != 50 {
+			t.Errorf("got %d want 50", got)
+		}
+	})
+
+}
@@ -0,0 +1,133 @@
+package sales_update
+
+import (
+	"context"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"sales-worker/pkg/log"
+	"sales-worker/pkg/resilience"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultExtensionCap - Longest time a message is kept invisible since it was received
+const defaultExtensionCap = 10 * time.Minute
+
+var visibilityExtensions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "sqs_visibility_extensions_total",
+	Help: "Visibility timeout extensions of messages in processing by result: extended, error or capped",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(visibilityExtensions)
+}
+
+// startHeartbeat - Extends the message visibility by one visibility timeout whenever a third
+// of the current window is left, until processing ends or the extension cap is reached.
+// When the message can't be kept invisible anymore, cancel stops the processing just before
+// the message is redelivered. The returned func ends the heartbeat.
+func startHeartbeat(ctx context.Context, cancel context.CancelFunc, sqsClient *sqs.SQS, queueURL string, msg *sqs.Message, visibility time.Duration, received_at time.Time) func() {
+	log := log.FromContext(ctx)
+	id := aws.StringValue(msg.MessageId)
+
+	done := make(chan struct{})
+	margin := visibility - processingDeadline(visibility)
+	limit := received_at.Add(visibilityExtensionCap(visibility))
+	expires_at := received_at.Add(visibility)
+
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(expires_at.Add(-visibility / 3)))
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			now := time.Now()
+			extend_by := visibility
+			if remaining := limit.Sub(now); remaining < extend_by {
+				extend_by = remaining
+			}
+
+			if extend_by < time.Second {
+				visibilityExtensions.WithLabelValues("capped").Inc()
+				log.Warn().
+					Str("Action", "heartbeat").
+					Str("MessageId", id).
+					Dur("Processing", now.Sub(received_at)).
+					Msg("Visibility extension cap reached")
+				break
+			}
+
+			seconds := int64(math.Ceil(extend_by.Seconds()))
+			err := resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+				_, err := sqsClient.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          aws.String(queueURL),
+					ReceiptHandle:     msg.ReceiptHandle,
+					VisibilityTimeout: aws.Int64(seconds),
+				})
+				return err
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				visibilityExtensions.WithLabelValues("error").Inc()
+				log.Error().
+					Str("Action", "heartbeat").
+					Str("MessageId", id).
+					Str("Error", err.Error()).
+					Msg("Error to extend message visibility")
+				break
+			}
+
+			expires_at = now.Add(time.Duration(seconds) * time.Second)
+			visibilityExtensions.WithLabelValues("extended").Inc()
+			log.Debug().
+				Str("Action", "heartbeat").
+				Str("MessageId", id).
+				Time("VisibleAt", expires_at).
+				Msg("Message visibility extended")
+		}
+
+		// No more extensions: give up before another consumer receives the message
+		timer := time.NewTimer(time.Until(expires_at.Add(-margin)))
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		case <-timer.C:
+			log.Warn().
+				Str("Action", "heartbeat").
+				Str("MessageId", id).
+				Msg("Cancelling processing; message visibility is about to expire")
+			cancel()
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
+
+// visibilityExtensionCap - VISIBILITY_EXTENSION_CAP_SECONDS, never below the visibility timeout
+func visibilityExtensionCap(visibility time.Duration) time.Duration {
+	extension_cap := defaultExtensionCap
+	if seconds, err := strconv.Atoi(os.Getenv("VISIBILITY_EXTENSION_CAP_SECONDS")); err == nil && seconds > 0 {
+		extension_cap = time.Duration(seconds) * time.Second
+	}
+	if extension_cap < visibility {
+		return visibility
+	}
+	return extension_cap
+}
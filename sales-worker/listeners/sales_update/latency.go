@@ -0,0 +1,63 @@
+package sales_update
+
+import (
+	"strconv"
+	"time"
+
+	"sales-worker/pkg/slo"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	endToEndLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sales_end_to_end_latency_seconds",
+		Help:    "Time from the event creation on POST /sales to the end of its processing",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+	}, []string{"event_type"})
+
+	queueWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sales_queue_wait_seconds",
+		Help:    "Time from the SQS SentTimestamp to the ReceiveMessage that returned the message",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+	})
+
+	processingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sales_processing_duration_seconds",
+		Help:    "Time spent processing a received message by result",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(endToEndLatency, queueWait, processingDuration)
+}
+
+// observeQueueWait - SentTimestamp is the epoch in milliseconds SQS accepted the message
+func observeQueueWait(msg *sqs.Message, received_at time.Time) {
+	sent, err := strconv.ParseInt(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]), 10, 64)
+	if err != nil {
+		return
+	}
+
+	if wait := received_at.Sub(time.UnixMilli(sent)); wait >= 0 {
+		queueWait.Observe(wait.Seconds())
+	}
+}
+
+// observeEndToEnd - Latency from the event creation; also counted against the SLO
+func observeEndToEnd(event_type string, occurred_at time.Time) {
+	if occurred_at.IsZero() {
+		return
+	}
+
+	latency := time.Since(occurred_at)
+	if latency < 0 {
+		latency = 0
+	}
+
+	endToEndLatency.WithLabelValues(event_type).Observe(latency.Seconds())
+	slo.Record(latency)
+}
@@ -1,16 +1,24 @@
 package sales_update
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"sales-worker/models/sales_model"
+	"sales-worker/pkg/archive"
+	"sales-worker/pkg/codec"
+	"sales-worker/pkg/events"
+	"sales-worker/pkg/failure"
 	"sales-worker/pkg/log"
 	"sales-worker/pkg/parameter_store"
-	"sales-worker/pkg/s3"
+	"sales-worker/pkg/resilience"
+	"sales-worker/pkg/sns"
+	"sales-worker/pkg/supervisor"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -18,204 +26,339 @@ import (
 	"github.com/aws/aws-sdk-go/service/sqs"
 )
 
-func ConsumeMessages(sqsClient *sqs.SQS, queueURL string, thread int) {
+// releaseTimeout - Bounds the visibility reset of unfinished messages during shutdown and the
+// release of claims whose message ran out of time
+const releaseTimeout = 5 * time.Second
 
-	log := log.Instance()
+// ConsumeMessages - Polls the queue until stop is cancelled and hands every received batch to
+// processBatch. Messages in flight keep running on drain, which is cancelled when the shutdown
+// grace period expires; unfinished messages are then released back to the queue
+func ConsumeMessages(stop context.Context, drain context.Context, sqsClient *sqs.SQS, queueURL string, thread int) {
+
+	logger := log.Instance().With().Int("Thread", thread).Logger()
+	ctx := supervisor.WithThread(log.WithContext(drain, logger), thread)
+	poll_ctx := supervisor.WithThread(log.WithContext(stop, logger), thread)
+	log := log.FromContext(ctx)
 
-	aws_region := os.Getenv("AWS_REGION")
-	ssm_site_state_parameter := os.Getenv("SSM_PARAMETER_STORE_STATE")
 	sqs_sales_queue := os.Getenv("SQS_SALES_QUEUE")
 
 	log.Info().
 		Str("Action", "consume").
-		Str("Region", aws_region).
-		Int("Thread", thread).
 		Str("SQS_Queue", sqs_sales_queue).
 		Msg("Starting Consumer Thread")
 
-	for {
+	setState(thread, StatePolling)
+	defer removeStatus(thread)
+
+	// Messages must finish before the heartbeat stops extending their visibility
+	visibility := queueVisibilityTimeout(ctx, sqsClient, queueURL)
+
+	// Consecutive polling failures; backs off the loop instead of spinning while a dependency is down
+	failures := 0
+	backoff := func(dependency string) {
+		delay := resilience.GetPolicy(dependency).Delay(failures)
+		failures++
+		log.Warn().
+			Str("Action", "consume").
+			Str("Dependency", dependency).
+			Int("Failures", failures).
+			Dur("Backoff", delay).
+			Msg("Backing off consumer loop")
+
+		setState(thread, StateBackoff)
+		select {
+		case <-stop.Done():
+		case <-time.After(delay):
+		}
+	}
+
+	for stop.Err() == nil {
+		supervisor.Beat(poll_ctx)
+
+		// Paused from the admin API: no new ReceiveMessage calls until resumed
+		if Paused() {
+			setState(thread, StatePaused)
+			select {
+			case <-stop.Done():
+			case <-time.After(pausePollInterval):
+			}
+			continue
+		}
+
+		site_state, err := parameter_store.GetSiteStateWithContext(poll_ctx, 30)
 
-		site_state, err := parameter_store.GetParamValue(ssm_site_state_parameter, 30)
+		if stop.Err() != nil {
+			break
+		}
 
 		if err != nil {
 			log.Error().
 				Str("Action", "consume").
-				Int("Thread", thread).
-				Str("Region", aws_region).
-				Str("State", site_state).
 				Str("SQS_Queue", sqs_sales_queue).
 				Str("Error", err.Error()).
 				Msg("Error to recover SSM Site State from Parameter Store")
+			backoff(resilience.SSM)
 			continue
 		}
 
-		result, err := sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
-			QueueUrl:            aws.String(queueURL),
-			MaxNumberOfMessages: aws.Int64(10),
-			WaitTimeSeconds:     aws.Int64(20),
+		if site_state != ActiveState && PassiveMode() == PassiveStop {
+			log.Debug().
+				Str("Action", "consume").
+				Str("SQS_Queue", sqs_sales_queue).
+				Msg("Polling paused; Site is not Active")
+			setState(thread, StatePassive)
+			waitPassive(stop)
+			continue
+		}
+
+		setState(thread, StatePolling)
+
+		var result *sqs.ReceiveMessageOutput
+		err = resilience.Call(poll_ctx, resilience.SQS, func(ctx context.Context) error {
+			result, err = sqsClient.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+				QueueUrl:              aws.String(queueURL),
+				MaxNumberOfMessages:   aws.Int64(prefetch()),
+				WaitTimeSeconds:       aws.Int64(20),
+				MessageAttributeNames: aws.StringSlice([]string{"All"}),
+				AttributeNames: aws.StringSlice([]string{
+					sqs.MessageSystemAttributeNameApproximateReceiveCount,
+					sqs.MessageSystemAttributeNameSentTimestamp,
+					// Kept when a passive consumer moves the message to a FIFO queue
+					sqs.MessageSystemAttributeNameMessageGroupId,
+				}),
+			})
+			return err
 		})
 
+		if stop.Err() != nil {
+			break
+		}
+
 		if err != nil {
 			log.Error().
 				Str("Action", "consume").
-				Int("Thread", thread).
-				Str("Region", aws_region).
-				Str("State", site_state).
 				Str("SQS_Queue", sqs_sales_queue).
 				Str("Error", err.Error()).
-				Msg("Starting SQS Worker Service")
+				Msg("Error to receive messages from SQS")
+			backoff(resilience.SQS)
 			continue
 		}
 
-		for _, msg := range result.Messages {
+		failures = 0
+		received_at := time.Now()
 
-			log.Info().
-				Str("Action", "consume").
-				Str("Region", aws_region).
-				Int("Thread", thread).
-				Str("State", site_state).
-				Str("SQS_Queue", sqs_sales_queue).
-				Str("Body", *msg.Body).
-				Msg("Message")
-
-			// Process Message
-			err := processSale(*msg.MessageId, *msg.Body, site_state, thread)
-
-			if err == nil {
-				_, err := sqsClient.DeleteMessage(&sqs.DeleteMessageInput{
-					QueueUrl:      aws.String(queueURL),
-					ReceiptHandle: msg.ReceiptHandle,
-				})
-
-				if err != nil {
-					log.Error().
-						Str("Action", "consume").
-						Str("Region", aws_region).
-						Int("Thread", thread).
-						Str("State", site_state).
-						Str("SQS_Queue", sqs_sales_queue).
-						Str("Error", err.Error()).
-						Msg("Error to delete Message from Queue")
-					continue
-				} else {
-					log.Info().
-						Str("Region", aws_region).
-						Str("State", site_state).
-						Int("Thread", thread).
-						Str("SQS_Queue", sqs_sales_queue).
-						Str("MessageId", *msg.MessageId).
-						Msg("Message removed from queue")
-				}
-			} else {
-				log.Error().
-					Str("Action", "consume").
-					Str("Region", aws_region).
-					Int("Thread", thread).
-					Str("State", site_state).
-					Str("SQS_Queue", sqs_sales_queue).
-					Str("Error", err.Error()).
-					Str("MessageId", *msg.MessageId).
-					Msg("Error process sale")
-				continue
-			}
+		updateStatus(thread, func(status *ThreadStatus) {
+			status.LastReceive = received_at
+			status.State = StateProcessing
+		})
 
-		}
+		handled, failed := processBatch(ctx, stop, sqsClient, queueURL, result.Messages, site_state, visibility, received_at)
+
+		updateStatus(thread, func(status *ThreadStatus) {
+			status.Handled += int64(handled)
+			status.Failed += int64(failed)
+		})
 	}
+
+	log.Info().
+		Str("Action", "consume").
+		Str("SQS_Queue", sqs_sales_queue).
+		Msg("Consumer Thread stopped")
 }
 
-func processSale(id string, message string, state string, thread int) error {
+// releaseMessages - Sets the visibility of the messages to zero so another consumer receives them right away
+func releaseMessages(ctx context.Context, sqsClient *sqs.SQS, queueURL string, messages []*sqs.Message) {
+	log := log.FromContext(ctx)
 
-	log := log.Instance()
-	aws_region := os.Getenv("AWS_REGION")
+	release_ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	for _, msg := range messages {
+		_, err := sqsClient.ChangeMessageVisibilityWithContext(release_ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(queueURL),
+			ReceiptHandle:     msg.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(0),
+		})
+		if err != nil {
+			log.Error().
+				Str("Action", "release").
+				Str("MessageId", aws.StringValue(msg.MessageId)).
+				Str("Error", err.Error()).
+				Msg("Error to release message back to the queue")
+			continue
+		}
 
-	if state != "ACTIVE" {
 		log.Info().
-			Str("Region", aws_region).
-			Str("State", state).
-			Int("Thread", thread).
-			Str("MessageId", id).
-			Msg("Dry-Running Message; Site is not Active")
-		return nil
+			Str("Action", "release").
+			Str("MessageId", aws.StringValue(msg.MessageId)).
+			Msg("Message released back to the queue")
 	}
+}
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(aws_region),
+const (
+	defaultIdempotencyLease = 5 * time.Minute
+	defaultIdempotencyTTL   = 7 * 24 * time.Hour
+)
+
+// defaultVisibilityTimeout - SQS default, used when the queue attributes can't be read
+const defaultVisibilityTimeout = 30 * time.Second
+
+// queueVisibilityTimeout - Reads the VisibilityTimeout attribute of the queue
+func queueVisibilityTimeout(ctx context.Context, sqsClient *sqs.SQS, queueURL string) time.Duration {
+	log := log.FromContext(ctx)
+
+	var result *sqs.GetQueueAttributesOutput
+	err := resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		var err error
+		result, err = sqsClient.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queueURL),
+			AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameVisibilityTimeout}),
+		})
+		return err
 	})
 	if err != nil {
-		return err
+		log.Warn().
+			Str("Action", "consume").
+			Str("Error", err.Error()).
+			Dur("VisibilityTimeout", defaultVisibilityTimeout).
+			Msg("Error to read queue visibility timeout; Assuming SQS default")
+		return defaultVisibilityTimeout
 	}
 
-	svc := dynamodb.New(sess)
-	dao := sales_model.NewModelDAO(svc)
+	seconds, err := strconv.Atoi(aws.StringValue(result.Attributes[sqs.QueueAttributeNameVisibilityTimeout]))
+	if err != nil || seconds <= 0 {
+		return defaultVisibilityTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
 
-	log.Info().
-		Str("Region", aws_region).
-		Str("State", state).
-		Int("Thread", thread).
-		Str("Sale", id).
-		Msg("Processing Message; Site is Active")
+// processingDeadline - Keeps a tenth of the visibility timeout, at least one second, to
+// delete the message before it becomes visible to other consumers
+func processingDeadline(visibility time.Duration) time.Duration {
+	margin := visibility / 10
+	if margin < time.Second {
+		margin = time.Second
+	}
+	if visibility <= margin {
+		return visibility
+	}
+	return visibility - margin
+}
 
-	sale := sales_model.Model{}
+// errDuplicate - Returned by handlers for events already processed; the message is
+// acknowledged without counting the redelivery against the SLO
+var errDuplicate = errors.New("event already processed")
 
-	err = json.Unmarshal([]byte(message), &sale)
-	if err != nil {
-		return err
+// handlers - Event processors routed by the envelope type
+var handlers = map[string]func(ctx context.Context, event *events.Envelope) error{
+	events.SaleCreated: processSale,
+}
+
+func processMessage(ctx context.Context, msg *sqs.Message, state string) error {
+
+	message := &codec.Message{
+		Body:       aws.StringValue(msg.Body),
+		Attributes: make(map[string]string, len(msg.MessageAttributes)),
+	}
+	for name, attribute := range msg.MessageAttributes {
+		message.Attributes[name] = aws.StringValue(attribute.StringValue)
 	}
 
-	log.Info().
-		Str("Region", aws_region).
-		Str("State", state).
-		Int("Thread", thread).
-		Str("Sale", sale.ID).
-		Msg("Checking Idempotency")
+	// Subscriptions without raw message delivery wrap the event in an SNS notification
+	if notification, wrapped := sns.Unwrap(message.Body); wrapped {
+		if err := notification.Verify(); err != nil {
+			logger := log.FromContext(ctx)
+			logger.Error().
+				Str("MessageId", aws.StringValue(msg.MessageId)).
+				Str("TopicArn", notification.TopicArn).
+				Str("Error", err.Error()).
+				Msg("SNS notification rejected by signature verification")
+			return failure.NewPermanent(err)
+		}
 
-	idempotency, err := dao.CheckIdempotency(sale.ID)
-	if err != nil {
-		return err
+		message.Body = notification.Message
+		for name, value := range notification.Attributes() {
+			message.Attributes[name] = value
+		}
 	}
 
-	if idempotency {
-		log.Info().
-			Str("Region", aws_region).
-			Str("State", state).
-			Int("Thread", thread).
-			Str("Sale", sale.ID).
-			Msg("Sale already processed, item found in idempotency table")
-		return nil
+	// Attributes are only present when the publisher sent them
+	attributes := message.EventAttributes()
+	if attributes.EventType != "" {
+		ctx = log.WithContext(ctx, log.FromContext(ctx).With().
+			Str("EventType", attributes.EventType).
+			Str("Product", attributes.Product).
+			Str("SourceRegion", attributes.SourceRegion).
+			Str("SourceState", attributes.SiteState).
+			Logger())
 	}
 
-	sale.Processed = true
-	err = updateOnDynamoDB(sale, state, thread)
-	if err != nil {
-		return err
+	log := log.FromContext(ctx)
+	id := aws.StringValue(msg.MessageId)
+
+	if state != ActiveState {
+		return ErrSiteNotActive
 	}
 
-	err = saveSaleOnS3(sale.ID, message, state, thread)
+	if attributes.EventType != "" {
+		if _, found := handlers[attributes.EventType]; !found {
+			return failure.NewPermanent(fmt.Errorf("%w: no handler for %s", events.ErrUnsupportedEvent, attributes.EventType))
+		}
+	}
+
+	decoder := codec.ForMessage(message)
+
+	document, err := decoder.Decode(message)
 	if err != nil {
-		return err
+		log.Error().
+			Str("MessageId", id).
+			Str("ContentType", decoder.ContentType()).
+			Str("Error", err.Error()).
+			Msg("Error to decode message body")
+		return failure.NewPermanent(err)
 	}
 
-	err = dao.SetIdempotency(sale.ID)
+	event, err := events.Decode(document)
 	if err != nil {
-		return err
+		log.Error().
+			Str("MessageId", id).
+			Str("Error", err.Error()).
+			Msg("Message rejected by event schema validation")
+		return failure.NewPermanent(err)
+	}
+
+	handler, found := handlers[event.Type]
+	if !found {
+		return failure.NewPermanent(fmt.Errorf("%w: no handler for %s", events.ErrUnsupportedEvent, event.Type))
 	}
 
 	log.Info().
-		Str("Region", aws_region).
-		Str("State", state).
-		Int("Thread", thread).
 		Str("MessageId", id).
-		Msg("Sale saved on idempotency table")
+		Str("EventId", event.EventID).
+		Str("EventType", event.Type).
+		Int("SchemaVersion", event.SchemaVersion).
+		Str("SourceRegion", event.SourceRegion).
+		Msg("Routing event to handler")
+
+	err = handler(ctx, event)
+	if errors.Is(err, errDuplicate) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
+	observeEndToEnd(event.Type, event.OccurredAt)
 	return nil
 }
 
-func updateOnDynamoDB(pre_sale sales_model.Model, state string, thread int) error {
-	log := log.Instance()
+func processSale(ctx context.Context, event *events.Envelope) error {
+
+	log := log.FromContext(ctx)
 	aws_region := os.Getenv("AWS_REGION")
 
 	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(os.Getenv("AWS_REGION")),
+		Region: aws.String(aws_region),
 	})
 	if err != nil {
 		return err
@@ -224,96 +367,198 @@ func updateOnDynamoDB(pre_sale sales_model.Model, state string, thread int) erro
 	svc := dynamodb.New(sess)
 	dao := sales_model.NewModelDAO(svc)
 
-	sale, err := dao.GetByID(pre_sale.ID)
+	log.Info().
+		Str("EventId", event.EventID).
+		Msg("Processing Message; Site is Active")
+
+	sale := sales_model.Model{}
+
+	err = json.Unmarshal(event.Data, &sale)
+	if err != nil {
+		return failure.NewPermanent(err)
+	}
+
+	log.Info().
+		Str("Sale", sale.ID).
+		Msg("Claiming Idempotency")
+
+	owner := workerId()
+	ttl := idempotencyTTL()
+
+	err = dao.ClaimIdempotencyWithContext(ctx, sale.ID, owner, idempotencyLease(ctx), ttl)
+	if errors.Is(err, sales_model.ErrAlreadyProcessed) {
+		log.Info().
+			Str("Sale", sale.ID).
+			Msg("Sale already processed, item found in idempotency table")
+		return errDuplicate
+	}
+	if errors.Is(err, sales_model.ErrClaimedByOther) {
+		return failure.NewRetryable(err)
+	}
 	if err != nil {
-		log.Error().
-			Str("Region", aws_region).
-			Str("State", state).
-			Str("Error", err.Error()).
-			Msg("Error to execute DynamoDB Query")
 		return err
 	}
-	if sale == nil {
-		log.Warn().
-			Str("Action", "read").
-			Str("Region", aws_region).
-			Str("State", state).
-			Str("Id", pre_sale.ID).
-			Msg("Sale not found")
-		return errors.New("sale not found")
+
+	// Let the redelivery claim the sale right away instead of waiting for the lease
+	release := func(ctx context.Context) {
+		if release_err := dao.ReleaseIdempotencyWithContext(ctx, sale.ID, owner); release_err != nil {
+			log.Warn().
+				Str("Sale", sale.ID).
+				Str("Error", release_err.Error()).
+				Msg("Error to release idempotency claim; redelivery waits for the lease")
+		}
+	}
+
+	err = markProcessed(ctx, dao, sale, owner)
+	if err != nil {
+		release(ctx)
+		return err
+	}
+
+	// Archived only once processed, so the retries of a failed mark don't append it again
+	uploaded, err := archiveSale(ctx, event, sale)
+	if err != nil {
+		release(ctx)
+		return failure.NewRetryable(err)
 	}
 
+	// The claim completes, and the message is acked, only once the archive part holding the sale
+	// is stored; until then a redelivery claims it again and archives it again
+	return beforeAck(ctx, func(ctx context.Context) error {
+		var err error
+		select {
+		case err = <-uploaded:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			// ctx may be the expired deadline of the message
+			release_ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+			release(release_ctx)
+			cancel()
+			return failure.NewRetryable(err)
+		}
+
+		if err := dao.CompleteIdempotencyWithContext(ctx, sale.ID, owner, ttl); err != nil {
+			// Processed and archived; the claim only keeps redeliveries out until its lease ends
+			log.Warn().
+				Str("Sale", sale.ID).
+				Str("Error", err.Error()).
+				Msg("Error to complete idempotency claim")
+			return nil
+		}
+
+		log.Info().
+			Str("Sale", sale.ID).
+			Msg("Sale saved on idempotency table")
+		return nil
+	})
+}
+
+// markProcessed - Sets the processed flag while the idempotency claim is held
+func markProcessed(ctx context.Context, dao *sales_model.ModelDAO, sale sales_model.Model, owner string) error {
+	log := log.FromContext(ctx)
+
 	log.Info().
-		Str("Region", aws_region).
-		Str("State", state).
-		Int("Thread", thread).
 		Str("Id", sale.ID).
 		Str("Product", sale.Product).
 		Float64("Amount", sale.Amount).
-		Bool("Processed", sale.Processed).
 		Msg("Updating flag on DynamoDB Table")
 
-	err = dao.UpdatedProcessedFlag(sale.ID)
-	if err != nil {
+	err := dao.MarkProcessedWithContext(ctx, sale.ID, owner)
+
+	switch {
+	case errors.Is(err, sales_model.ErrSaleNotFound):
+		log.Warn().
+			Str("Action", "read").
+			Str("Id", sale.ID).
+			Msg("Sale not found")
+		// The sale may still be replicating from the source region
+		return failure.NewNotReplicated(err)
+	case errors.Is(err, sales_model.ErrSaleAlreadyProcessed):
+		// Flag set by an earlier run whose archive part never got stored; archive it again
+		log.Info().
+			Str("Id", sale.ID).
+			Msg("Sale flag already set; archiving it again")
+		return nil
+	case errors.Is(err, sales_model.ErrClaimLost), errors.Is(err, sales_model.ErrTransactionConflict):
+		return failure.NewRetryable(err)
+	case err != nil:
 		return err
 	}
 
 	log.Info().
-		Str("Region", aws_region).
-		Str("State", state).
-		Int("Thread", thread).
 		Str("Id", sale.ID).
 		Str("Product", sale.Product).
 		Float64("Amount", sale.Amount).
-		Bool("Processed", sale.Processed).
+		Bool("Processed", true).
 		Msg("Sale flag updated")
 
 	return nil
 }
 
-func saveSaleOnS3(id string, message string, state string, thread int) error {
-	log := log.Instance()
+// archiveSale - Appends the sale to the archive part of its UTC date and region; the channel
+// reports the upload of the part, which the writer runs in the background
+func archiveSale(ctx context.Context, event *events.Envelope, sale sales_model.Model) (<-chan error, error) {
+	log := log.FromContext(ctx)
 
-	now := time.Now()
-	formato := "20060102"
-	string_now := now.Format(formato)
+	created := event.OccurredAt
+	if sale.Timestamp > 0 {
+		created = time.Unix(sale.Timestamp, 0)
+	}
 
-	aws_region := os.Getenv("AWS_REGION")
-	bucket := os.Getenv("S3_SALES_BUCKET")
-	key := fmt.Sprintf("sales/%s/%s.json", string_now, id)
+	region := event.SourceRegion
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+
+	partition := archive.PartitionOf(created, region)
 	log.Info().
-		Str("Region", aws_region).
-		Str("State", state).
-		Int("Thread", thread).
-		Str("Bucket", bucket).
-		Str("Sale", id).
-		Msg("Uploading Sale to S3")
-
-	bytes := []byte(message)
-	err := s3.Save(bytes, bucket, key)
+		Str("Sale", sale.ID).
+		Str("Partition", partition.Path()).
+		Msg("Archiving Sale")
+
+	uploaded, err := archive.GetInstance().Append(partition, event.Data)
 	if err != nil {
 		log.Error().
-			Str("Region", aws_region).
-			Str("State", state).
-			Int("Thread", thread).
-			Str("Bucket", bucket).
-			Str("Sale", id).
-			Str("Path", key).
+			Str("Sale", sale.ID).
+			Str("Partition", partition.Path()).
 			Str("Error", err.Error()).
-			Msg("Error to save sale on S3")
-		return err
+			Msg("Error to archive sale")
+		return nil, err
 	}
 
 	log.Info().
-		Str("Region", aws_region).
-		Str("State", state).
-		Int("Thread", thread).
-		Str("Bucket", bucket).
-		Str("Sale", id).
-		Str("Path", key).
-		Msg("Sale saved on S3")
+		Str("Sale", sale.ID).
+		Str("Partition", partition.Path()).
+		Msg("Sale appended to archive part")
+	return uploaded, nil
+}
 
-	return nil
+// idempotencyLease - Claims last until the message processing deadline
+func idempotencyLease(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return defaultIdempotencyLease
+}
+
+// idempotencyTTL - IDEMPOTENCY_TTL_HOURS; age of idempotency records removed by the table TTL
+func idempotencyTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		return defaultIdempotencyTTL
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// workerId - Owner of the idempotency claims taken by this process
+func workerId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
 }
 
 // func checkIdempotency(id string, state string, thread int) bool {
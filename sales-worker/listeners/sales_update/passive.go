@@ -0,0 +1,269 @@
+package sales_update
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sales-worker/pkg/log"
+	"sales-worker/pkg/parameter_store"
+	"sales-worker/pkg/resilience"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Behaviors of the consumer while the site is not ACTIVE, set by PASSIVE_MODE
+const (
+	// PassiveStop - No ReceiveMessage calls; messages stay on the queue untouched
+	PassiveStop = "stop"
+	// PassiveBackoff - Messages are received and sent back to the queue delayed by
+	// PASSIVE_VISIBILITY_SECONDS
+	PassiveBackoff = "backoff"
+	// PassiveReplay - Messages are moved to SQS_SALES_REPLAY_QUEUE and moved back on promotion
+	PassiveReplay = "replay"
+
+	ActiveState = "ACTIVE"
+
+	defaultPassiveVisibility = 15 * time.Minute
+	// maxVisibility - Longest visibility timeout accepted by SQS
+	maxVisibility = 12 * time.Hour
+	// maxDelay - Longest message delay accepted by SQS
+	maxDelay = 15 * time.Minute
+	// passivePollInterval - How often a paused consumer or the replay drainer checks the site state
+	passivePollInterval = 30 * time.Second
+)
+
+var ErrSiteNotActive = errors.New("site is not active")
+
+// PassiveMode - PASSIVE_MODE, backoff by default
+func PassiveMode() string {
+	switch mode := strings.ToLower(os.Getenv("PASSIVE_MODE")); mode {
+	case PassiveStop, PassiveReplay:
+		return mode
+	default:
+		return PassiveBackoff
+	}
+}
+
+// passiveVisibility - PASSIVE_VISIBILITY_SECONDS; requeued messages are delayed by at most
+// 15 minutes. On FIFO queues every backoff still counts as a receive, so keep it long enough
+// that the queue redrive policy isn't reached before a failback
+func passiveVisibility() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("PASSIVE_VISIBILITY_SECONDS"))
+	if err != nil || seconds <= 0 {
+		return defaultPassiveVisibility
+	}
+	if visibility := time.Duration(seconds) * time.Second; visibility < maxVisibility {
+		return visibility
+	}
+	return maxVisibility
+}
+
+// handlePassive - Keeps a message received while the site is not ACTIVE without processing
+// or deleting it, according to PASSIVE_MODE
+func handlePassive(ctx context.Context, sqsClient *sqs.SQS, queueURL string, msg *sqs.Message) {
+	log := log.FromContext(ctx)
+	id := aws.StringValue(msg.MessageId)
+
+	mode := PassiveMode()
+	replay_queue := os.Getenv("SQS_SALES_REPLAY_QUEUE")
+
+	if mode == PassiveReplay && replay_queue != "" {
+		err := moveMessage(ctx, sqsClient, msg, replay_queue, queueURL, 0)
+		if err == nil {
+			log.Info().
+				Str("Action", "passive").
+				Str("MessageId", id).
+				Msg("Message moved to replay buffer; Site is not Active")
+			return
+		}
+		log.Error().
+			Str("Action", "passive").
+			Str("MessageId", id).
+			Str("Error", err.Error()).
+			Msg("Error to move message to replay buffer; backing off instead")
+		mode = PassiveBackoff
+	}
+
+	if mode == PassiveReplay {
+		log.Warn().
+			Str("Action", "passive").
+			Msg("SQS_SALES_REPLAY_QUEUE not set; backing off instead")
+		mode = PassiveBackoff
+	}
+
+	visibility := passiveVisibility()
+
+	// A fresh copy starts over at ApproximateReceiveCount 1, so passive receives neither reach
+	// the redrive policy nor shorten the retries of the first real failure. FIFO queues don't
+	// accept per-message delays and keep the visibility backoff
+	if mode == PassiveBackoff && !isFIFO(queueURL) {
+		delay := visibility
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+
+		err := moveMessage(ctx, sqsClient, msg, queueURL, queueURL, delay)
+		if err == nil {
+			log.Info().
+				Str("Action", "passive").
+				Str("MessageId", id).
+				Dur("Backoff", delay).
+				Msg("Message requeued; Site is not Active")
+			return
+		}
+		log.Error().
+			Str("Action", "passive").
+			Str("MessageId", id).
+			Str("Error", err.Error()).
+			Msg("Error to requeue message; changing its visibility instead")
+	}
+
+	if mode == PassiveStop {
+		// Received just before the consumer paused: hand it back untouched
+		visibility = 0
+	}
+
+	err := resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		_, err := sqsClient.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(queueURL),
+			ReceiptHandle:     msg.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(int64(visibility.Seconds())),
+		})
+		return err
+	})
+	if err != nil {
+		log.Error().
+			Str("Action", "passive").
+			Str("MessageId", id).
+			Str("Error", err.Error()).
+			Msg("Error to change message visibility; redelivery follows the queue visibility timeout")
+		return
+	}
+
+	log.Info().
+		Str("Action", "passive").
+		Str("MessageId", id).
+		Dur("Backoff", visibility).
+		Msg("Message left on the queue; Site is not Active")
+}
+
+// moveMessage - Sends a copy of the message to the target queue, delivered after delay, and only
+// then deletes it from source
+func moveMessage(ctx context.Context, sqsClient *sqs.SQS, msg *sqs.Message, target string, source string, delay time.Duration) error {
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(target),
+		MessageBody:       msg.Body,
+		MessageAttributes: msg.MessageAttributes,
+	}
+
+	if isFIFO(target) {
+		// FIFO queues take no per-message delay and require the group; the message id dedups
+		// a retried send without dropping other copies of the sale
+		input.MessageGroupId = aws.String(messageGroupId(msg))
+		input.MessageDeduplicationId = msg.MessageId
+	} else {
+		input.DelaySeconds = aws.Int64(int64(delay.Seconds()))
+	}
+
+	err := resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		_, err := sqsClient.SendMessageWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// A failed delete only duplicates the message; idempotency absorbs it
+	return resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		_, err := sqsClient.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(source),
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+		return err
+	})
+}
+
+// messageGroupId - Group of a message received from a FIFO queue; messages from standard queues
+// get their own group, as they had no order to keep
+func messageGroupId(msg *sqs.Message) string {
+	if group_id := aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameMessageGroupId]); group_id != "" {
+		return group_id
+	}
+	return aws.StringValue(msg.MessageId)
+}
+
+// isFIFO - FIFO queue URLs end with the .fifo suffix
+func isFIFO(queueURL string) bool {
+	return strings.HasSuffix(queueURL, ".fifo")
+}
+
+// waitPassive - Pauses a consumer in PassiveStop mode until the next site state check
+func waitPassive(stop context.Context) {
+	select {
+	case <-stop.Done():
+	case <-time.After(passivePollInterval):
+	}
+}
+
+// DrainReplayBuffer - Moves the messages buffered in SQS_SALES_REPLAY_QUEUE back to the sales
+// queue whenever the site is ACTIVE, until stop is cancelled
+func DrainReplayBuffer(stop context.Context, sqsClient *sqs.SQS, queueURL string) {
+	replay_queue := os.Getenv("SQS_SALES_REPLAY_QUEUE")
+	ctx := log.WithContext(stop, log.Instance().With().Str("Action", "replay").Logger())
+	log := log.FromContext(ctx)
+
+	if replay_queue == "" {
+		log.Warn().Msg("SQS_SALES_REPLAY_QUEUE not set; replay buffer drainer disabled")
+		return
+	}
+
+	for stop.Err() == nil {
+		site_state, err := parameter_store.GetSiteStateWithContext(ctx, 30)
+		if err != nil || site_state != ActiveState {
+			waitPassive(stop)
+			continue
+		}
+
+		var result *sqs.ReceiveMessageOutput
+		err = resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+			result, err = sqsClient.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+				QueueUrl:              aws.String(replay_queue),
+				MaxNumberOfMessages:   aws.Int64(maxBatchSize),
+				WaitTimeSeconds:       aws.Int64(1),
+				MessageAttributeNames: aws.StringSlice([]string{"All"}),
+				AttributeNames:        aws.StringSlice([]string{sqs.MessageSystemAttributeNameMessageGroupId}),
+			})
+			return err
+		})
+		if err != nil || len(result.Messages) == 0 {
+			if err != nil && stop.Err() == nil {
+				log.Error().
+					Str("Error", err.Error()).
+					Msg("Error to receive messages from replay buffer")
+			}
+			waitPassive(stop)
+			continue
+		}
+
+		moved := 0
+		for _, msg := range result.Messages {
+			if err := moveMessage(ctx, sqsClient, msg, queueURL, replay_queue, 0); err != nil {
+				log.Error().
+					Str("MessageId", aws.StringValue(msg.MessageId)).
+					Str("Error", err.Error()).
+					Msg("Error to move message back to the sales queue")
+				continue
+			}
+			moved++
+		}
+
+		log.Info().
+			Int("Messages", moved).
+			Msg("Replay buffer messages moved back to the sales queue")
+	}
+}
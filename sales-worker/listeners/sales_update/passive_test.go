@@ -0,0 +1,155 @@
+package sales_update
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestHandlePassive(t *testing.T) {
+
+	tests := map[string]struct {
+		mode       string
+		queue      string
+		visibility string
+		actions    []string
+		delay      string
+	}{
+		"Backoff Requeues":            {PassiveBackoff, "https://sqs.us-east-1.amazonaws.com/0/sales", "300", []string{"SendMessage", "DeleteMessage"}, "300"},
+		"Backoff Delay Capped":        {PassiveBackoff, "https://sqs.us-east-1.amazonaws.com/0/sales", "3600", []string{"SendMessage", "DeleteMessage"}, "900"},
+		"Backoff On FIFO Queue":       {PassiveBackoff, "https://sqs.us-east-1.amazonaws.com/0/sales.fifo", "300", []string{"ChangeMessageVisibility"}, ""},
+		"Stop Hands Message Back":     {PassiveStop, "https://sqs.us-east-1.amazonaws.com/0/sales", "300", []string{"ChangeMessageVisibility"}, ""},
+		"Replay Without Replay Queue": {PassiveReplay, "https://sqs.us-east-1.amazonaws.com/0/sales", "300", []string{"SendMessage", "DeleteMessage"}, "300"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("PASSIVE_MODE", test.mode)
+			t.Setenv("PASSIVE_VISIBILITY_SECONDS", test.visibility)
+			t.Setenv("SQS_SALES_REPLAY_QUEUE", "")
+
+			fake, client := newFakeSQS(t)
+			handlePassive(context.Background(), client, test.queue, &sqs.Message{
+				MessageId:     aws.String("1"),
+				ReceiptHandle: aws.String("receipt-1"),
+				Body:          aws.String(`{"type":"sale.created"}`),
+			})
+
+			if got := fake.actions(); fmt.Sprint(got) != fmt.Sprint(test.actions) {
+				t.Fatalf("got actions %v want %v", got, test.actions)
+			}
+
+			if test.delay != "" {
+				send := fake.calls[0]
+				if send.Get("QueueUrl") != test.queue {
+					t.Errorf("requeued to %s want %s", send.Get("QueueUrl"), test.queue)
+				}
+				if send.Get("DelaySeconds") != test.delay {
+					t.Errorf("got delay %s want %s", send.Get("DelaySeconds"), test.delay)
+				}
+			}
+		})
+	}
+
+}
+
+func TestMoveMessage(t *testing.T) {
+
+	tests := map[string]struct {
+		source   string
+		target   string
+		group_id string
+		want     string
+	}{
+		"Standard Queue":             {"https://sqs.us-east-1.amazonaws.com/0/sales", "https://sqs.us-east-1.amazonaws.com/0/sales-replay", "", ""},
+		"FIFO Replay Queue":          {"https://sqs.us-east-1.amazonaws.com/0/sales.fifo", "https://sqs.us-east-1.amazonaws.com/0/sales-replay.fifo", "sale-1", "sale-1"},
+		"FIFO Sales Queue":           {"https://sqs.us-east-1.amazonaws.com/0/sales-replay.fifo", "https://sqs.us-east-1.amazonaws.com/0/sales.fifo", "sale-1", "sale-1"},
+		"FIFO From A Standard Queue": {"https://sqs.us-east-1.amazonaws.com/0/sales-replay", "https://sqs.us-east-1.amazonaws.com/0/sales.fifo", "", "1"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, client := newFakeSQS(t)
+
+			msg := &sqs.Message{
+				MessageId:     aws.String("1"),
+				ReceiptHandle: aws.String("receipt-1"),
+				Body:          aws.String(`{"type":"sale.created"}`),
+				Attributes:    map[string]*string{},
+			}
+			if test.group_id != "" {
+				msg.Attributes[sqs.MessageSystemAttributeNameMessageGroupId] = aws.String(test.group_id)
+			}
+
+			if err := moveMessage(context.Background(), client, msg, test.target, test.source, 0); err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.actions(); fmt.Sprint(got) != "[SendMessage DeleteMessage]" {
+				t.Fatalf("got actions %v", got)
+			}
+
+			send := fake.calls[0]
+			if send.Get("MessageGroupId") != test.want {
+				t.Errorf("got group %q want %q", send.Get("MessageGroupId"), test.want)
+			}
+			if isFIFO(test.target) {
+				if send.Get("MessageDeduplicationId") != "1" {
+					t.Errorf("got deduplication id %q want the message id", send.Get("MessageDeduplicationId"))
+				}
+				if _, found := send["DelaySeconds"]; found {
+					t.Errorf("FIFO queues reject per-message delays")
+				}
+			} else if _, found := send["MessageDeduplicationId"]; found {
+				t.Errorf("standard queues reject deduplication ids")
+			}
+		})
+	}
+
+	t.Run("Replay On FIFO Queues", func(t *testing.T) {
+		t.Setenv("PASSIVE_MODE", PassiveReplay)
+		t.Setenv("SQS_SALES_REPLAY_QUEUE", "https://sqs.us-east-1.amazonaws.com/0/sales-replay.fifo")
+
+		fake, client := newFakeSQS(t)
+		handlePassive(context.Background(), client, "https://sqs.us-east-1.amazonaws.com/0/sales.fifo", &sqs.Message{
+			MessageId:     aws.String("1"),
+			ReceiptHandle: aws.String("receipt-1"),
+			Body:          aws.String(`{"type":"sale.created"}`),
+			Attributes:    map[string]*string{sqs.MessageSystemAttributeNameMessageGroupId: aws.String("sale-1")},
+		})
+
+		if got := fake.actions(); fmt.Sprint(got) != "[SendMessage DeleteMessage]" {
+			t.Fatalf("got actions %v want the message moved to the replay buffer", got)
+		}
+		if send := fake.calls[0]; send.Get("QueueUrl") != "https://sqs.us-east-1.amazonaws.com/0/sales-replay.fifo" || send.Get("MessageGroupId") != "sale-1" {
+			t.Errorf("unexpected send %v", send)
+		}
+	})
+
+}
+
+func TestPassiveVisibility(t *testing.T) {
+
+	tests := map[string]struct {
+		value string
+		want  time.Duration
+	}{
+		"Default":     {"", defaultPassiveVisibility},
+		"Invalid":     {"soon", defaultPassiveVisibility},
+		"Set":         {"120", 2 * time.Minute},
+		"Above Limit": {"86400", maxVisibility},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("PASSIVE_VISIBILITY_SECONDS", test.value)
+			if got := passiveVisibility(); got != test.want {
+				t.Errorf("got %s want %s", got, test.want)
+			}
+		})
+	}
+
+}
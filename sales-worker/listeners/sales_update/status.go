@@ -0,0 +1,88 @@
+package sales_update
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Consumer thread states reported by the admin API
+const (
+	StatePolling    = "polling"
+	StateProcessing = "processing"
+	StateBackoff    = "backoff"
+	StatePassive    = "passive"
+	StatePaused     = "paused"
+)
+
+// pausePollInterval - How often a paused consumer checks for a resume
+const pausePollInterval = time.Second
+
+// ThreadStatus - Snapshot of one consumer goroutine
+type ThreadStatus struct {
+	Thread      int       `json:"thread"`
+	State       string    `json:"state"`
+	LastReceive time.Time `json:"last_receive"`
+	Handled     int64     `json:"messages_handled"`
+	Failed      int64     `json:"messages_failed"`
+}
+
+var (
+	statusMutex sync.Mutex
+	statuses    = make(map[int]*ThreadStatus)
+	paused      int32
+)
+
+// Pause - Consumers stop calling ReceiveMessage after their current batch
+func Pause() {
+	atomic.StoreInt32(&paused, 1)
+}
+
+// Resume - Consumers go back to polling
+func Resume() {
+	atomic.StoreInt32(&paused, 0)
+}
+
+func Paused() bool {
+	return atomic.LoadInt32(&paused) == 1
+}
+
+// Statuses - Consumer threads running, ordered by thread
+func Statuses() []ThreadStatus {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	snapshot := make([]ThreadStatus, 0, len(statuses))
+	for _, status := range statuses {
+		snapshot = append(snapshot, *status)
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Thread < snapshot[j].Thread
+	})
+	return snapshot
+}
+
+func updateStatus(thread int, update func(status *ThreadStatus)) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	status, found := statuses[thread]
+	if !found {
+		status = &ThreadStatus{Thread: thread}
+		statuses[thread] = status
+	}
+	update(status)
+}
+
+func setState(thread int, state string) {
+	updateStatus(thread, func(status *ThreadStatus) {
+		status.State = state
+	})
+}
+
+func removeStatus(thread int) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	delete(statuses, thread)
+}
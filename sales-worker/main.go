@@ -1,29 +1,55 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"os"
 	"os/signal"
 	"sales-worker/pkg/log"
 	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
+	"sales-worker/pkg/archive"
+	"sales-worker/pkg/auth"
+	"sales-worker/pkg/autoscaler"
+	"sales-worker/pkg/export"
 	"sales-worker/pkg/parameter_store"
+	"sales-worker/pkg/resilience"
+	"sales-worker/pkg/slo"
+	"sales-worker/pkg/sns"
+	"sales-worker/pkg/supervisor"
 
+	"sales-worker/admin"
 	"sales-worker/listeners/sales_update"
+	"sales-worker/models/sales_model"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/sqs"
 )
 
+// Build info; commit and build time are set with -ldflags "-X main.commit=... -X main.buildTime=..."
+var (
+	version   = "v1"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
 func main() {
 
-	log := log.Instance()
+	log := log.Setup(log.Config{
+		Service: "sales-worker",
+		Version: version,
+		Region:  os.Getenv("AWS_REGION"),
+		Level:   os.Getenv("LOG_LEVEL"),
+		Format:  os.Getenv("LOG_FORMAT"),
+	})
 
 	aws_region := os.Getenv("AWS_REGION")
-	ssm_site_state_parameter := os.Getenv("SSM_PARAMETER_STORE_STATE")
 	sqs_sales_queue := os.Getenv("SQS_SALES_QUEUE")
 	threads := os.Getenv("CONSUMER_THREADS")
 
@@ -31,7 +57,6 @@ func main() {
 	if err != nil {
 		log.Error().
 			Str("Action", "consume").
-			Str("Region", aws_region).
 			Str("Threads", threads).
 			Str("SQS_Queue", sqs_sales_queue).
 			Str("Error", err.Error()).
@@ -43,13 +68,22 @@ func main() {
 		num_threads = 2
 	}
 
-	site_state, err := parameter_store.GetParamValue(ssm_site_state_parameter, 30)
+	resilience.Setup(resilienceConfig())
+
+	// SNS signature verification; only used when raw message delivery is disabled
+	if err := sns.Setup(os.Getenv("SNS_SIGNING_CERT_FILE")); err != nil {
+		log.Error().
+			Str("Action", "consume").
+			Str("Error", err.Error()).
+			Msg("Error to load SNS signing certificate")
+		os.Exit(1)
+	}
+
+	_, err = parameter_store.GetSiteState(30)
 
 	if err != nil {
 		log.Error().
 			Str("Action", "consume").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("SQS_Queue", sqs_sales_queue).
 			Str("Error", err.Error()).
 			Msg("Error to recover SSM Site State from Parameter Store")
@@ -66,39 +100,335 @@ func main() {
 	if err != nil {
 		log.Error().
 			Str("Action", "consume").
-			Str("Region", aws_region).
-			Str("State", site_state).
 			Str("SQS_Queue", sqs_sales_queue).
 			Str("Error", err.Error()).
 			Msg("Error to create SQS Session")
 		return
 	}
 
-	// Iniciar o consumo de mensagens da fila SQS
-	for i := 0; i < num_threads; i++ {
-		sqsClient := sqs.New(sess)
-		go sales_update.ConsumeMessages(sqsClient, sqs_sales_queue, i)
+	// stop ends the polling; drain bounds the messages still in flight
+	stop, stopConsumers := context.WithCancel(context.Background())
+	drain, cancelDrain := context.WithCancel(context.Background())
+
+	var consumers sync.WaitGroup
+
+	// The writer outlives the consumers, whose messages wait for the upload of their archive parts
+	archiver, stopArchiver := context.WithCancel(context.Background())
+	archived := make(chan struct{})
+	writer := archive.Setup(archiveConfig())
+	go func() {
+		defer close(archived)
+		writer.Run(archiver)
+	}()
+
+	// Iniciar o consumo de mensagens da fila SQS; CONSUMER_THREADS is the minimum of the autoscaler
+	scaler := autoscaler.New(autoscalerConfig(num_threads), sqs.New(sess), cloudwatch.New(sess), sqs_sales_queue,
+		supervisor.Supervise(func(stop context.Context, thread int) {
+			sales_update.ConsumeMessages(stop, drain, sqs.New(sess), sqs_sales_queue, thread)
+		}), &consumers)
+
+	consumers.Add(1)
+	go func() {
+		defer consumers.Done()
+		scaler.Run(stop)
+	}()
+
+	// End-to-end latency objective; the failover signal exposed on /slo and sales_slo_breaching
+	slo.Setup(sloConfig())
+	consumers.Add(1)
+	go func() {
+		defer consumers.Done()
+		slo.Run(stop, 30*time.Second, scaler.OldestMessageAge)
+	}()
+
+	// Daily Parquet export of the archive
+	if enabled, _ := strconv.ParseBool(os.Getenv("EXPORT_ENABLED")); enabled {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			config := exportConfig()
+			config.Lock = sales_model.NewModelDAO(dynamodb.New(sess))
+			export.Schedule(stop, config, exportOffset())
+		}()
+	}
+
+	// Replay buffer of the messages received while the site was not ACTIVE
+	if sales_update.PassiveMode() == sales_update.PassiveReplay {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			sales_update.DrainReplayBuffer(stop, sqs.New(sess), sqs_sales_queue)
+		}()
+	}
+
+	// Admin API
+	authenticator, err := auth.New(authConfig())
+	if err != nil {
+		log.Error().
+			Str("Action", "auth").
+			Str("Error", err.Error()).
+			Msg("Failed to load authentication credentials")
+		os.Exit(1)
+	}
+
+	// SSM API keys may be unavailable during a failover; the admin API serves the known keys
+	// and keeps refreshing them
+	if !authenticator.Ready() {
+		log.Warn().
+			Str("Action", "auth").
+			Msg("API keys not loaded from SSM; admin API accepts the static keys only")
 	}
+	go authenticator.RefreshEvery(stop, time.Minute, func(err error) {
+		log.Warn().
+			Str("Action", "auth").
+			Str("Error", err.Error()).
+			Msg("Failed to refresh API keys from SSM; keeping the last known keys")
+	})
+
+	handler := admin.New(admin.Options{
+		Authenticator:  authenticator,
+		Scaler:         scaler,
+		Stop:           stop,
+		LivenessWindow: livenessWindow(),
+		Build: admin.BuildInfo{
+			Version:   version,
+			Commit:    commit,
+			BuildTime: buildTime,
+		},
+	})
 
-	http.HandleFunc("/healthcheck", healthcheckHandler)
 	port := ":8090"
-	fmt.Printf("Server running on %s\n", port)
+	log.Info().
+		Str("Port", port).
+		Msg("Server running")
+
+	srv := &http.Server{
+		Addr:    port,
+		Handler: handler,
+	}
 
-	go http.ListenAndServe(port, nil)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error().
+				Str("Error", err.Error()).
+				Msg("Failed to listen")
+		}
+	}()
 
 	waitForExitSignal()
+
+	// 1. Stop issuing new ReceiveMessage calls and upload the archive parts messages wait for
+	grace_period := shutdownGracePeriod()
+	log.Info().
+		Dur("GracePeriod", grace_period).
+		Msg("Stopping consumer; draining messages in flight")
+	stopConsumers()
+	writer.Flush()
+
+	// 2. Let messages in flight finish within the grace period
+	// 3. Past it, cancel them; the consumers release unfinished messages to the queue
+	if !waitTimeout(&consumers, grace_period) {
+		log.Warn().
+			Dur("GracePeriod", grace_period).
+			Msg("Grace period expired; releasing unfinished messages")
+		cancelDrain()
+		consumers.Wait()
+	}
+	cancelDrain()
+
+	log.Info().Msg("Consumer drained")
+
+	// Upload the archive parts of the messages released unfinished
+	stopArchiver()
+	<-archived
+
+	// 4. Flush logs; metrics stay scrapeable until the HTTP server goes down
+	os.Stderr.Sync()
+
+	// 5. Shut down the HTTP server
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Error().
+			Str("Error", err.Error()).
+			Msg("Failed to shut down HTTP server")
+	}
 }
 
 func waitForExitSignal() {
-	log := log.Instance()
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	<-signals
-	log.Info().Msg("Stopping consumer")
-	os.Exit(0)
 }
 
-func healthcheckHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, "OK")
+// waitTimeout - Waits for the group; false when the timeout comes first
+func waitTimeout(group *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		group.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// shutdownGracePeriod - SHUTDOWN_GRACE_PERIOD_SECONDS, 25 seconds by default to fit the
+// 30 seconds ECS and Kubernetes wait before killing the container
+func shutdownGracePeriod() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("SHUTDOWN_GRACE_PERIOD_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = 25
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// livenessWindow - LIVENESS_WINDOW_SECONDS, 5 minutes by default; longer than a 20 second
+// long poll plus a batch of slow messages
+func livenessWindow() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("LIVENESS_WINDOW_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = 300
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// archiveConfig - S3 archive part files from S3_SALES_BUCKET and the ARCHIVE_* variables
+func archiveConfig() archive.Config {
+	config := archive.DefaultConfig
+	config.Bucket = os.Getenv("S3_SALES_BUCKET")
+
+	if value := os.Getenv("ARCHIVE_PREFIX"); value != "" {
+		config.Prefix = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("ARCHIVE_MAX_BYTES")); err == nil && value > 0 {
+		config.MaxBytes = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("ARCHIVE_MAX_RECORDS")); err == nil && value > 0 {
+		config.MaxRecords = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("ARCHIVE_MAX_AGE_SECONDS")); err == nil && value > 0 {
+		config.MaxAge = time.Duration(value) * time.Second
+	}
+
+	return config
+}
+
+// exportConfig - Parquet export of the archive bucket to EXPORT_DESTINATION, the same bucket by default
+func exportConfig() export.Config {
+	source := archive.OpenStorage("s3://" + os.Getenv("S3_SALES_BUCKET"))
+
+	destination := source
+	if value := os.Getenv("EXPORT_DESTINATION"); value != "" {
+		destination = archive.OpenStorage(value)
+	}
+
+	return export.Config{
+		Source:        source,
+		Destination:   destination,
+		ArchivePrefix: os.Getenv("ARCHIVE_PREFIX"),
+		OutputPrefix:  os.Getenv("EXPORT_PREFIX"),
+		Region:        os.Getenv("AWS_REGION"),
+	}
+}
+
+// exportOffset - EXPORT_OFFSET_MINUTES past midnight UTC the previous day is exported, 60 by default
+func exportOffset() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("EXPORT_OFFSET_MINUTES"))
+	if err != nil || minutes < 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// authConfig - Admin API credentials from the AUTH_* variables; same model as the REST API
+func authConfig() auth.Config {
+	enabled, _ := strconv.ParseBool(os.Getenv("AUTH_ENABLED"))
+	return auth.Config{
+		Enabled:          enabled,
+		ApiKeysParameter: os.Getenv("AUTH_API_KEYS_PARAMETER"),
+		JWKSFile:         os.Getenv("AUTH_JWKS_FILE"),
+		Issuer:           os.Getenv("AUTH_ISSUER"),
+		Audience:         os.Getenv("AUTH_AUDIENCE"),
+	}
+}
+
+// autoscalerConfig - Consumer thread bounds from MIN/MAX_CONSUMER_THREADS and the AUTOSCALE_* variables;
+// without MAX_CONSUMER_THREADS the thread count stays fixed
+func autoscalerConfig(threads int) autoscaler.Config {
+	config := autoscaler.Config{
+		MinThreads:        threads,
+		MaxThreads:        threads,
+		Interval:          30 * time.Second,
+		MessagesPerThread: 100,
+		MaxMessageAge:     5 * time.Minute,
+		ScaleUpCooldown:   time.Minute,
+		ScaleDownCooldown: 5 * time.Minute,
+	}
+
+	if value, err := strconv.Atoi(os.Getenv("MIN_CONSUMER_THREADS")); err == nil && value > 0 {
+		config.MinThreads = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("MAX_CONSUMER_THREADS")); err == nil && value > 0 {
+		config.MaxThreads = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("AUTOSCALE_MESSAGES_PER_THREAD")); err == nil && value > 0 {
+		config.MessagesPerThread = value
+	}
+
+	for variable, field := range map[string]*time.Duration{
+		"AUTOSCALE_INTERVAL_SECONDS":            &config.Interval,
+		"AUTOSCALE_MAX_MESSAGE_AGE_SECONDS":     &config.MaxMessageAge,
+		"AUTOSCALE_SCALE_UP_COOLDOWN_SECONDS":   &config.ScaleUpCooldown,
+		"AUTOSCALE_SCALE_DOWN_COOLDOWN_SECONDS": &config.ScaleDownCooldown,
+	} {
+		if value, err := strconv.Atoi(os.Getenv(variable)); err == nil && value > 0 {
+			*field = time.Duration(value) * time.Second
+		}
+	}
+
+	return config
+}
+
+// sloConfig - End-to-end latency objective from the SLO_* variables
+func sloConfig() slo.Config {
+	config := slo.DefaultConfig
+
+	if value, err := strconv.ParseFloat(os.Getenv("SLO_OBJECTIVE"), 64); err == nil {
+		config.Objective = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("SLO_LATENCY_THRESHOLD_SECONDS")); err == nil && value > 0 {
+		config.Threshold = time.Duration(value) * time.Second
+	}
+	if value, err := strconv.ParseFloat(os.Getenv("SLO_FAST_BURN_RATE"), 64); err == nil {
+		config.FastBurnRate = value
+	}
+	if value, err := strconv.ParseFloat(os.Getenv("SLO_SLOW_BURN_RATE"), 64); err == nil {
+		config.SlowBurnRate = value
+	}
+
+	return config
+}
+
+// resilienceConfig - Retry and circuit breaker settings from RETRY_* and BREAKER_* environment variables
+func resilienceConfig() resilience.Config {
+	settings := resilience.DefaultSettings
+
+	for variable, field := range map[string]*int{
+		"RETRY_MAX_ATTEMPTS":        &settings.MaxAttempts,
+		"RETRY_BASE_DELAY_MS":       &settings.BaseDelayMs,
+		"RETRY_MAX_DELAY_MS":        &settings.MaxDelayMs,
+		"BREAKER_FAILURE_THRESHOLD": &settings.FailureThreshold,
+		"BREAKER_OPEN_SECONDS":      &settings.OpenSeconds,
+	} {
+		if value, err := strconv.Atoi(os.Getenv(variable)); err == nil && value > 0 {
+			*field = value
+		}
+	}
+
+	return resilience.Config{Default: settings}
 }
@@ -0,0 +1,69 @@
+package sales_model
+
+import (
+	"context"
+	"time"
+
+	"sales-worker/pkg/resilience"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// MaxBatchGet - Keys per BatchGetItem call
+const MaxBatchGet = 100
+
+// BatchGetWithContext - Sales found for the ids, at most MaxBatchGet, keyed by id
+func (dao *ModelDAO) BatchGetWithContext(ctx context.Context, ids []string) (map[string]Model, error) {
+	keys := make([]map[string]*dynamodb.AttributeValue, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}})
+	}
+
+	found := make(map[string]Model, len(ids))
+	request := map[string]*dynamodb.KeysAndAttributes{
+		dao.tableName: {Keys: keys, ConsistentRead: aws.Bool(true)},
+	}
+
+	for attempt := 0; len(request) > 0; attempt++ {
+		var output *dynamodb.BatchGetItemOutput
+		err := resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+			var err error
+			output, err = dao.client.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var items []Model
+		if err := dynamodbattribute.UnmarshalListOfMaps(output.Responses[dao.tableName], &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			found[item.ID] = item
+		}
+
+		request = output.UnprocessedKeys
+		if err := waitUnprocessed(ctx, len(request), attempt); err != nil {
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
+
+// waitUnprocessed - Backs off before resending the items a throttled batch left unprocessed
+func waitUnprocessed(ctx context.Context, unprocessed int, attempt int) error {
+	if unprocessed == 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(resilience.GetPolicy(resilience.DynamoDB).Delay(attempt)):
+		return nil
+	}
+}
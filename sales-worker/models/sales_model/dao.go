@@ -1,8 +1,11 @@
 package sales_model
 
 import (
+	"context"
 	"os"
 
+	"sales-worker/pkg/resilience"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
@@ -25,6 +28,10 @@ func NewModelDAO(client *dynamodb.DynamoDB) *ModelDAO {
 }
 
 func (dao *ModelDAO) Create(model *Model) error {
+	return dao.CreateWithContext(context.Background(), model)
+}
+
+func (dao *ModelDAO) CreateWithContext(ctx context.Context, model *Model) error {
 	av, err := dynamodbattribute.MarshalMap(model)
 	if err != nil {
 		return err
@@ -35,11 +42,17 @@ func (dao *ModelDAO) Create(model *Model) error {
 		TableName: aws.String(dao.tableName),
 	}
 
-	_, err = dao.client.PutItem(input)
-	return err
+	return resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.PutItemWithContext(ctx, input)
+		return err
+	})
 }
 
 func (dao *ModelDAO) GetByID(id string) (*Model, error) {
+	return dao.GetByIDWithContext(context.Background(), id)
+}
+
+func (dao *ModelDAO) GetByIDWithContext(ctx context.Context, id string) (*Model, error) {
 	input := &dynamodb.QueryInput{
 		TableName:              &dao.tableName,
 		KeyConditionExpression: aws.String("id = :value"),
@@ -50,7 +63,12 @@ func (dao *ModelDAO) GetByID(id string) (*Model, error) {
 		},
 	}
 
-	result, err := dao.client.Query(input)
+	var result *dynamodb.QueryOutput
+	err := resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		var err error
+		result, err = dao.client.QueryWithContext(ctx, input)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +87,10 @@ func (dao *ModelDAO) GetByID(id string) (*Model, error) {
 }
 
 func (dao *ModelDAO) Delete(id string) error {
+	return dao.DeleteWithContext(context.Background(), id)
+}
+
+func (dao *ModelDAO) DeleteWithContext(ctx context.Context, id string) error {
 	input := &dynamodb.DeleteItemInput{
 		TableName: aws.String(dao.tableName),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -78,74 +100,8 @@ func (dao *ModelDAO) Delete(id string) error {
 		},
 	}
 
-	_, err := dao.client.DeleteItem(input)
-	if err != nil {
+	return resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.DeleteItemWithContext(ctx, input)
 		return err
-	}
-
-	return nil
-}
-
-func (dao *ModelDAO) UpdatedProcessedFlag(id string) error {
-	key := map[string]*dynamodb.AttributeValue{
-		"id": {
-			S: aws.String(id),
-		},
-	}
-
-	updateExpression := "SET " + "sale_processed" + " = :value"
-	expressionAttributeValues := map[string]*dynamodb.AttributeValue{
-		":value": {
-			BOOL: aws.Bool(true),
-		},
-	}
-
-	input := &dynamodb.UpdateItemInput{
-		TableName:                 aws.String(dao.tableName),
-		Key:                       key,
-		UpdateExpression:          aws.String(updateExpression),
-		ExpressionAttributeValues: expressionAttributeValues,
-	}
-
-	_, err := dao.client.UpdateItem(input)
-	return err
-}
-
-func (dao *ModelDAO) SetIdempotency(id string) error {
-	item := map[string]*dynamodb.AttributeValue{
-		"id": {
-			S: aws.String(id),
-		},
-	}
-
-	input := &dynamodb.PutItemInput{
-		Item:      item,
-		TableName: aws.String(dao.tableIdempotency),
-	}
-
-	_, err := dao.client.PutItem(input)
-	return err
-}
-
-func (dao *ModelDAO) CheckIdempotency(id string) (bool, error) {
-	input := &dynamodb.QueryInput{
-		TableName:              &dao.tableIdempotency,
-		KeyConditionExpression: aws.String("id = :value"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":value": {
-				S: aws.String(id),
-			},
-		},
-	}
-
-	result, err := dao.client.Query(input)
-	if err != nil {
-		return false, err
-	}
-
-	if len(result.Items) > 0 {
-		return true, nil
-	}
-
-	return false, nil
+	})
 }
@@ -0,0 +1,199 @@
+package sales_model
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"sales-worker/pkg/resilience"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Idempotency record states
+const (
+	IdempotencyInProgress = "IN_PROGRESS"
+	IdempotencyCompleted  = "COMPLETED"
+)
+
+var (
+	ErrAlreadyProcessed = errors.New("sale already processed")
+	ErrClaimedByOther   = errors.New("sale claimed by another worker")
+	ErrClaimLost        = errors.New("idempotency claim no longer owned by this worker")
+)
+
+// Idempotency - Claim of a sale by a worker; ExpiresAt is the table TTL attribute
+type Idempotency struct {
+	ID             string `dynamodbav:"id"`
+	Status         string `dynamodbav:"status"`
+	Owner          string `dynamodbav:"owner"`
+	LeaseExpiresAt int64  `dynamodbav:"lease_expires_at,omitempty"`
+	ExpiresAt      int64  `dynamodbav:"expires_at"`
+	UpdatedAt      int64  `dynamodbav:"updated_at"`
+}
+
+// ClaimIdempotencyWithContext - Claims the sale as IN_PROGRESS for owner until the lease
+// expires. Fails with ErrAlreadyProcessed when the sale is COMPLETED and with
+// ErrClaimedByOther while another worker holds a live lease; expired leases are taken over
+// and a claim already held by owner is renewed
+func (dao *ModelDAO) ClaimIdempotencyWithContext(ctx context.Context, id string, owner string, lease time.Duration, ttl time.Duration) error {
+	now := time.Now()
+
+	item, err := dynamodbattribute.MarshalMap(Idempotency{
+		ID:             id,
+		Status:         IdempotencyInProgress,
+		Owner:          owner,
+		LeaseExpiresAt: now.Add(lease).Unix(),
+		ExpiresAt:      now.Add(ttl).Unix(),
+		UpdatedAt:      now.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(dao.tableIdempotency),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id) OR (#status = :in_progress AND (lease_expires_at < :now OR #owner = :owner))"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+			"#owner":  aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":in_progress": {S: aws.String(IdempotencyInProgress)},
+			":owner":       {S: aws.String(owner)},
+			":now":         {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	}
+
+	err = resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.PutItemWithContext(ctx, input)
+		return err
+	})
+	if !isConditionalCheckFailed(err) {
+		return err
+	}
+
+	current, err := dao.GetIdempotencyWithContext(ctx, id)
+	if err != nil {
+		return err
+	}
+	return claimConflict(current, owner)
+}
+
+// claimConflict - Outcome of a claim whose condition failed, from the record read back
+func claimConflict(current *Idempotency, owner string) error {
+	switch {
+	case current == nil:
+		// Released between the claim and the read; the redelivery claims it again
+		return ErrClaimedByOther
+	case current.Status == IdempotencyCompleted:
+		return ErrAlreadyProcessed
+	case current.Owner == owner:
+		return nil
+	default:
+		return ErrClaimedByOther
+	}
+}
+
+// CompleteIdempotencyWithContext - Flips the claim of owner to COMPLETED and drops the lease
+func (dao *ModelDAO) CompleteIdempotencyWithContext(ctx context.Context, id string, owner string, ttl time.Duration) error {
+	now := time.Now()
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(dao.tableIdempotency),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		UpdateExpression:    aws.String("SET #status = :completed, expires_at = :expires_at, updated_at = :now REMOVE lease_expires_at"),
+		ConditionExpression: aws.String("#owner = :owner AND #status = :in_progress"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+			"#owner":  aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":completed":   {S: aws.String(IdempotencyCompleted)},
+			":in_progress": {S: aws.String(IdempotencyInProgress)},
+			":owner":       {S: aws.String(owner)},
+			":expires_at":  {N: aws.String(strconv.FormatInt(now.Add(ttl).Unix(), 10))},
+			":now":         {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	}
+
+	err := resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.UpdateItemWithContext(ctx, input)
+		return err
+	})
+	if isConditionalCheckFailed(err) {
+		return ErrClaimLost
+	}
+	return err
+}
+
+// ReleaseIdempotencyWithContext - Deletes the IN_PROGRESS claim of owner so a redelivery
+// doesn't wait for the lease to expire
+func (dao *ModelDAO) ReleaseIdempotencyWithContext(ctx context.Context, id string, owner string) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String(dao.tableIdempotency),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		ConditionExpression: aws.String("#owner = :owner AND #status = :in_progress"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+			"#owner":  aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":in_progress": {S: aws.String(IdempotencyInProgress)},
+			":owner":       {S: aws.String(owner)},
+		},
+	}
+
+	err := resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.DeleteItemWithContext(ctx, input)
+		return err
+	})
+	if isConditionalCheckFailed(err) {
+		return ErrClaimLost
+	}
+	return err
+}
+
+func (dao *ModelDAO) GetIdempotencyWithContext(ctx context.Context, id string) (*Idempotency, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(dao.tableIdempotency),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	var result *dynamodb.GetItemOutput
+	err := resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		var err error
+		result, err = dao.client.GetItemWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	record := &Idempotency{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func isConditionalCheckFailed(err error) bool {
+	var aws_err awserr.Error
+	return errors.As(err, &aws_err) && aws_err.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
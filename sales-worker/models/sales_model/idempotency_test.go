@@ -0,0 +1,150 @@
+package sales_model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// fakeDynamo - Answers each DynamoDB operation with the handler registered for it and
+// records the requests received
+type fakeDynamo struct {
+	mutex    sync.Mutex
+	handlers map[string]func(body map[string]interface{}) (int, interface{})
+	requests map[string][]map[string]interface{}
+}
+
+func (f *fakeDynamo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	f.mutex.Lock()
+	f.requests[operation] = append(f.requests[operation], body)
+	handler := f.handlers[operation]
+	f.mutex.Unlock()
+
+	status, response := http.StatusOK, interface{}(map[string]interface{}{})
+	if handler != nil {
+		status, response = handler(body)
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func newFakeDynamo(t *testing.T) (*fakeDynamo, *ModelDAO) {
+	fake := &fakeDynamo{
+		handlers: map[string]func(body map[string]interface{}) (int, interface{}){},
+		requests: map[string][]map[string]interface{}{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+
+	return fake, &ModelDAO{
+		tableName:        "sales",
+		tableIdempotency: "sales-idempotency",
+		client:           dynamodb.New(sess),
+	}
+}
+
+// conditionalCheckFailed - Error response of a write whose condition expression failed
+func conditionalCheckFailed(map[string]interface{}) (int, interface{}) {
+	return http.StatusBadRequest, map[string]string{
+		"__type":  "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException",
+		"message": "The conditional request failed",
+	}
+}
+
+func TestClaimConflict(t *testing.T) {
+
+	tests := map[string]struct {
+		current *Idempotency
+		want    error
+	}{
+		"Released Meanwhile": {nil, ErrClaimedByOther},
+		"Completed":          {&Idempotency{Status: IdempotencyCompleted, Owner: "worker-b"}, ErrAlreadyProcessed},
+		"Completed By Owner": {&Idempotency{Status: IdempotencyCompleted, Owner: "worker-a"}, ErrAlreadyProcessed},
+		"Held By Other":      {&Idempotency{Status: IdempotencyInProgress, Owner: "worker-b"}, ErrClaimedByOther},
+		"Held By Owner":      {&Idempotency{Status: IdempotencyInProgress, Owner: "worker-a"}, nil},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := claimConflict(test.current, "worker-a"); err != test.want {
+				t.Errorf("got %v want %v", err, test.want)
+			}
+		})
+	}
+
+}
+
+func TestClaimIdempotency(t *testing.T) {
+
+	record := func(status string, owner string) func(map[string]interface{}) (int, interface{}) {
+		return func(map[string]interface{}) (int, interface{}) {
+			item, _ := dynamodbattribute.MarshalMap(Idempotency{ID: "sale-1", Status: status, Owner: owner})
+			return http.StatusOK, dynamodb.GetItemOutput{Item: item}
+		}
+	}
+
+	t.Run("Claimed", func(t *testing.T) {
+		fake, dao := newFakeDynamo(t)
+		if err := dao.ClaimIdempotencyWithContext(context.Background(), "sale-1", "worker-a", time.Minute, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		put := fake.requests["PutItem"][0]
+		if !strings.Contains(put["ConditionExpression"].(string), "#owner = :owner") {
+			t.Errorf("claim condition doesn't renew the lease of its owner: %s", put["ConditionExpression"])
+		}
+		values := put["ExpressionAttributeValues"].(map[string]interface{})
+		if owner := values[":owner"].(map[string]interface{})["S"]; owner != "worker-a" {
+			t.Errorf("got owner %v want worker-a", owner)
+		}
+	})
+
+	tests := map[string]struct {
+		get  func(map[string]interface{}) (int, interface{})
+		want error
+	}{
+		"Completed":     {record(IdempotencyCompleted, "worker-b"), ErrAlreadyProcessed},
+		"Held By Other": {record(IdempotencyInProgress, "worker-b"), ErrClaimedByOther},
+		"Held By Owner": {record(IdempotencyInProgress, "worker-a"), nil},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, dao := newFakeDynamo(t)
+			fake.handlers["PutItem"] = conditionalCheckFailed
+			fake.handlers["GetItem"] = test.get
+
+			err := dao.ClaimIdempotencyWithContext(context.Background(), "sale-1", "worker-a", time.Minute, time.Hour)
+			if !errors.Is(err, test.want) {
+				t.Errorf("got %v want %v", err, test.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,97 @@
+package sales_model
+
+import (
+	"context"
+	"errors"
+
+	"sales-worker/pkg/resilience"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var (
+	ErrSaleNotFound         = errors.New("sale not found")
+	ErrSaleAlreadyProcessed = errors.New("sale already flagged as processed")
+	ErrTransactionConflict  = errors.New("sale updated by a concurrent transaction")
+)
+
+// Positions of the items in the MarkProcessed transaction, matching its cancellation reasons
+const (
+	saleItem = iota
+	idempotencyItem
+)
+
+// MarkProcessedWithContext - Flags the sale as processed in one transaction with a check that
+// owner still holds its idempotency claim; the claim is completed by CompleteIdempotency once
+// the sale is archived. Cancellations map to ErrSaleNotFound, ErrSaleAlreadyProcessed,
+// ErrClaimLost or ErrTransactionConflict
+func (dao *ModelDAO) MarkProcessedWithContext(ctx context.Context, id string, owner string) error {
+	key := map[string]*dynamodb.AttributeValue{
+		"id": {S: aws.String(id)},
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			saleItem: {
+				Update: &dynamodb.Update{
+					TableName:           aws.String(dao.tableName),
+					Key:                 key,
+					UpdateExpression:    aws.String("SET sale_processed = :processed"),
+					ConditionExpression: aws.String("attribute_exists(id) AND (attribute_not_exists(sale_processed) OR sale_processed = :not_processed)"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":processed":     {BOOL: aws.Bool(true)},
+						":not_processed": {BOOL: aws.Bool(false)},
+					},
+					// The old item tells a missing sale apart from a processed one
+					ReturnValuesOnConditionCheckFailure: aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+				},
+			},
+			idempotencyItem: {
+				ConditionCheck: &dynamodb.ConditionCheck{
+					TableName:           aws.String(dao.tableIdempotency),
+					Key:                 key,
+					ConditionExpression: aws.String("#owner = :owner AND #status = :in_progress"),
+					ExpressionAttributeNames: map[string]*string{
+						"#status": aws.String("status"),
+						"#owner":  aws.String("owner"),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":in_progress": {S: aws.String(IdempotencyInProgress)},
+						":owner":       {S: aws.String(owner)},
+					},
+				},
+			},
+		},
+	}
+
+	err := resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.TransactWriteItemsWithContext(ctx, input)
+		return err
+	})
+
+	var canceled *dynamodb.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return err
+	}
+	return cancellationError(canceled)
+}
+
+// cancellationError - First meaningful reason of a cancelled MarkProcessed transaction
+func cancellationError(canceled *dynamodb.TransactionCanceledException) error {
+	for index, reason := range canceled.CancellationReasons {
+		switch aws.StringValue(reason.Code) {
+		case "ConditionalCheckFailed":
+			if index == idempotencyItem {
+				return ErrClaimLost
+			}
+			if len(reason.Item) == 0 {
+				return ErrSaleNotFound
+			}
+			return ErrSaleAlreadyProcessed
+		case "TransactionConflict":
+			return ErrTransactionConflict
+		}
+	}
+	return canceled
+}
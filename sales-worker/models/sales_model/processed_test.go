@@ -0,0 +1,67 @@
+package sales_model
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// transactionCanceled - Error response of a cancelled transaction with one reason per item
+func transactionCanceled(reasons ...map[string]interface{}) func(map[string]interface{}) (int, interface{}) {
+	return func(map[string]interface{}) (int, interface{}) {
+		return http.StatusBadRequest, map[string]interface{}{
+			"__type":              "com.amazonaws.dynamodb.v20120810#TransactionCanceledException",
+			"message":             "Transaction cancelled, please refer cancellation reasons for specific reasons",
+			"CancellationReasons": reasons,
+		}
+	}
+}
+
+func TestMarkProcessed(t *testing.T) {
+
+	none := map[string]interface{}{"Code": "None"}
+	failed := map[string]interface{}{"Code": "ConditionalCheckFailed"}
+	processed := map[string]interface{}{
+		"Code": "ConditionalCheckFailed",
+		"Item": map[string]interface{}{
+			"id":             map[string]interface{}{"S": "sale-1"},
+			"sale_processed": map[string]interface{}{"BOOL": true},
+		},
+	}
+	conflict := map[string]interface{}{"Code": "TransactionConflict"}
+
+	tests := map[string]struct {
+		handler func(map[string]interface{}) (int, interface{})
+		want    error
+	}{
+		"Marked":               {nil, nil},
+		"Sale Missing":         {transactionCanceled(failed, none), ErrSaleNotFound},
+		"Already Processed":    {transactionCanceled(processed, none), ErrSaleAlreadyProcessed},
+		"Claim Lost":           {transactionCanceled(none, failed), ErrClaimLost},
+		"Transaction Conflict": {transactionCanceled(conflict, none), ErrTransactionConflict},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, dao := newFakeDynamo(t)
+			fake.handlers["TransactWriteItems"] = test.handler
+
+			err := dao.MarkProcessedWithContext(context.Background(), "sale-1", "worker-a")
+			if !errors.Is(err, test.want) {
+				t.Errorf("got %v want %v", err, test.want)
+			}
+		})
+	}
+
+	t.Run("Unknown Reason", func(t *testing.T) {
+		fake, dao := newFakeDynamo(t)
+		fake.handlers["TransactWriteItems"] = transactionCanceled(map[string]interface{}{"Code": "ThrottlingError"}, none)
+
+		err := dao.MarkProcessedWithContext(context.Background(), "sale-1", "worker-a")
+		if err == nil || errors.Is(err, ErrSaleNotFound) || errors.Is(err, ErrTransactionConflict) {
+			t.Errorf("got %v want the cancellation itself", err)
+		}
+	})
+
+}
@@ -0,0 +1,69 @@
+package sales_model
+
+import (
+	"context"
+	"strconv"
+
+	"sales-worker/pkg/resilience"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// RestoreWithContext - Writes the archived sale unless the table holds a newer copy or the same
+// one already processed; false when the table item was kept. The condition keeps a sale a
+// consumer writes meanwhile from being overwritten by an older archived copy. One PutItem per
+// sale instead of BatchWriteItem, which takes no condition expressions and would overwrite it
+func (dao *ModelDAO) RestoreWithContext(ctx context.Context, model Model) (bool, error) {
+	item, err := dynamodbattribute.MarshalMap(model)
+	if err != nil {
+		return false, err
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(dao.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id) OR #timestamp < :timestamp OR (#timestamp = :timestamp AND (attribute_not_exists(sale_processed) OR sale_processed = :not_processed))"),
+		ExpressionAttributeNames: map[string]*string{
+			"#timestamp": aws.String("timestamp"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":timestamp":     {N: aws.String(strconv.FormatInt(model.Timestamp, 10))},
+			":not_processed": {BOOL: aws.Bool(false)},
+		},
+	}
+
+	err = resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.PutItemWithContext(ctx, input)
+		return err
+	})
+	if isConditionalCheckFailed(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RestoreIdempotencyWithContext - Writes the rebuilt idempotency record only where the sale has
+// none; false when a record exists, e.g. the live IN_PROGRESS claim of a consumer
+func (dao *ModelDAO) RestoreIdempotencyWithContext(ctx context.Context, record Idempotency) (bool, error) {
+	item, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		return false, err
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(dao.tableIdempotency),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	}
+
+	err = resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := dao.client.PutItemWithContext(ctx, input)
+		return err
+	})
+	if isConditionalCheckFailed(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,86 @@
+package sales_model
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+
+	tests := map[string]struct {
+		put     func(map[string]interface{}) (int, interface{})
+		written bool
+	}{
+		"Written":        {nil, true},
+		"Newer In Table": {conditionalCheckFailed, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, dao := newFakeDynamo(t)
+			fake.handlers["PutItem"] = test.put
+
+			written, err := dao.RestoreWithContext(context.Background(), Model{ID: "sale-1", Timestamp: 1792400000, Processed: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written != test.written {
+				t.Errorf("got written %v want %v", written, test.written)
+			}
+
+			condition := fake.requests["PutItem"][0]["ConditionExpression"].(string)
+			if !strings.Contains(condition, "#timestamp < :timestamp") {
+				t.Errorf("restore overwrites newer sales: %s", condition)
+			}
+		})
+	}
+
+	t.Run("Dependency Error", func(t *testing.T) {
+		fake, dao := newFakeDynamo(t)
+		fake.handlers["PutItem"] = func(map[string]interface{}) (int, interface{}) {
+			return http.StatusBadRequest, map[string]string{
+				"__type":  "com.amazonaws.dynamodb.v20120810#ValidationException",
+				"message": "invalid item",
+			}
+		}
+
+		if written, err := dao.RestoreWithContext(context.Background(), Model{ID: "sale-1"}); err == nil || written {
+			t.Errorf("got written %v, error %v", written, err)
+		}
+	})
+
+}
+
+func TestRestoreIdempotency(t *testing.T) {
+
+	tests := map[string]struct {
+		put     func(map[string]interface{}) (int, interface{})
+		created bool
+	}{
+		"Missing Record":  {nil, true},
+		"Existing Record": {conditionalCheckFailed, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, dao := newFakeDynamo(t)
+			fake.handlers["PutItem"] = test.put
+
+			created, err := dao.RestoreIdempotencyWithContext(context.Background(), Idempotency{ID: "sale-1", Status: IdempotencyCompleted, Owner: "restore"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created != test.created {
+				t.Errorf("got created %v want %v", created, test.created)
+			}
+
+			put := fake.requests["PutItem"][0]
+			if put["TableName"] != "sales-idempotency" || put["ConditionExpression"] != "attribute_not_exists(id)" {
+				t.Errorf("got table %v condition %v", put["TableName"], put["ConditionExpression"])
+			}
+		})
+	}
+
+}
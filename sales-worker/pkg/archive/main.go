@@ -0,0 +1,350 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"sales-worker/pkg/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config - Destination of the part files and when a part is flushed; the first of MaxBytes
+// (uncompressed), MaxRecords or MaxAge closes it. Storage defaults to the S3 Bucket
+type Config struct {
+	Bucket     string
+	Prefix     string
+	MaxBytes   int
+	MaxRecords int
+	MaxAge     time.Duration
+	Storage    Storage
+}
+
+var DefaultConfig = Config{
+	Prefix:     "sales",
+	MaxBytes:   64 << 20,
+	MaxRecords: 50000,
+	MaxAge:     10 * time.Second,
+}
+
+const (
+	// uploadTimeout - Bounds one part upload attempt, retries of the S3 client included
+	uploadTimeout = time.Minute
+
+	// Backoff between the upload attempts of a failed part
+	uploadRetryBaseDelay = time.Second
+	uploadRetryMaxDelay  = time.Minute
+)
+
+var (
+	ErrClosed      = errors.New("archive writer is closed")
+	ErrPartDropped = errors.New("archive part dropped")
+)
+
+// Partition - Hive partition of a sale: its UTC date and region
+type Partition struct {
+	Year   int
+	Month  int
+	Day    int
+	Region string
+}
+
+// PartitionOf - Partition of a sale created at timestamp in region
+func PartitionOf(timestamp time.Time, region string) Partition {
+	utc := timestamp.UTC()
+	return Partition{Year: utc.Year(), Month: int(utc.Month()), Day: utc.Day(), Region: region}
+}
+
+// Path - year=YYYY/month=MM/day=DD/region=<region>
+func (p Partition) Path() string {
+	return fmt.Sprintf("year=%04d/month=%02d/day=%02d/region=%s", p.Year, p.Month, p.Day, p.Region)
+}
+
+// part - Open gzip NDJSON file of one partition and the appends waiting for its upload
+type part struct {
+	partition Partition
+	buffer    bytes.Buffer
+	gzip      *gzip.Writer
+	records   int
+	size      int
+	opened    time.Time
+	waiters   []chan error
+}
+
+// done - Reports the upload result to the appends of the part
+func (p *part) done(err error) {
+	for _, waiter := range p.waiters {
+		waiter <- err
+	}
+}
+
+var (
+	partsWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sales_archive_parts_total",
+		Help: "Archive part upload attempts by result; dropped parts failed their last attempt on Close",
+	}, []string{"result"})
+
+	partRecords = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sales_archive_part_records",
+		Help:    "Sales per archive part file",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 9),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(partsWritten, partRecords)
+}
+
+// Writer - Buffers sales into one part per partition and uploads them as gzip NDJSON objects
+type Writer struct {
+	config   Config
+	owner    string
+	mutex    sync.Mutex
+	parts    map[Partition]*part
+	sequence int64
+	uploads  sync.WaitGroup
+	closed   bool
+	closing  chan struct{}
+}
+
+var (
+	mutex    sync.Mutex
+	instance *Writer
+)
+
+// New - Writer of the config; zero fields keep their defaults
+func New(config Config) *Writer {
+	if config.Bucket == "" {
+		config.Bucket = os.Getenv("S3_SALES_BUCKET")
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultConfig.Prefix
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultConfig.MaxBytes
+	}
+	if config.MaxRecords <= 0 {
+		config.MaxRecords = DefaultConfig.MaxRecords
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultConfig.MaxAge
+	}
+	if config.Storage == nil {
+		config.Storage = &S3Storage{Bucket: config.Bucket}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &Writer{
+		config:  config,
+		owner:   fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		parts:   make(map[Partition]*part),
+		closing: make(chan struct{}),
+	}
+}
+
+// Setup - Builds the writer and keeps it as the process singleton
+func Setup(config Config) *Writer {
+	mutex.Lock()
+	defer mutex.Unlock()
+	instance = New(config)
+	return instance
+}
+
+// GetInstance - Writer Singleton - Default config when Setup was not called
+func GetInstance() *Writer {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if instance == nil {
+		instance = New(Config{})
+	}
+	return instance
+}
+
+// Append - Adds the sale to the open part of its partition without waiting for the upload; the
+// returned channel receives nil once the part is stored, or ErrPartDropped. Callers keep the
+// message of the sale unacked until then, so a sale is never acked before it is archived
+func (w *Writer) Append(partition Partition, sale json.RawMessage) (<-chan error, error) {
+	var line bytes.Buffer
+	if err := json.Compact(&line, sale); err != nil {
+		return nil, err
+	}
+	line.WriteByte('\n')
+
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil, ErrClosed
+	}
+
+	current, found := w.parts[partition]
+	if !found {
+		current = &part{partition: partition, opened: time.Now()}
+		current.gzip = gzip.NewWriter(&current.buffer)
+		w.parts[partition] = current
+	}
+
+	if _, err := current.gzip.Write(line.Bytes()); err != nil {
+		w.mutex.Unlock()
+		return nil, err
+	}
+	current.records++
+	current.size += line.Len()
+
+	done := make(chan error, 1)
+	current.waiters = append(current.waiters, done)
+
+	if current.records >= w.config.MaxRecords || current.size >= w.config.MaxBytes {
+		w.flushLocked(current)
+	}
+	w.mutex.Unlock()
+
+	return done, nil
+}
+
+// Run - Flushes parts older than MaxAge until stop is cancelled, then flushes the rest and
+// waits for the uploads; cancel stop only after the consumers drained
+func (w *Writer) Run(stop context.Context) {
+	ticker := time.NewTicker(w.config.MaxAge / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop.Done():
+			w.Close()
+			return
+		case <-ticker.C:
+			w.mutex.Lock()
+			for _, current := range w.parts {
+				if time.Since(current.opened) >= w.config.MaxAge {
+					w.flushLocked(current)
+				}
+			}
+			w.mutex.Unlock()
+		}
+	}
+}
+
+// Flush - Uploads every open part now, so the messages waiting for them don't wait for MaxAge
+func (w *Writer) Flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, current := range w.parts {
+		w.flushLocked(current)
+	}
+}
+
+// Close - Flushes every open part and waits for the uploads; parts still failing get one last
+// attempt and are dropped after it, failing their appends with ErrPartDropped so their messages
+// stay unacked and are archived again on redelivery. Later appends fail with ErrClosed
+func (w *Writer) Close() {
+	w.mutex.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.closing)
+	}
+	for _, current := range w.parts {
+		w.flushLocked(current)
+	}
+	w.mutex.Unlock()
+
+	w.uploads.Wait()
+}
+
+// flushLocked - Detaches the part from its partition and uploads it in the background
+func (w *Writer) flushLocked(current *part) {
+	delete(w.parts, current.partition)
+	w.sequence++
+
+	key := fmt.Sprintf("%s/%s/part-%d-%s-%d.ndjson.gz",
+		w.config.Prefix, current.partition.Path(), time.Now().UTC().UnixNano(), w.owner, w.sequence)
+
+	w.uploads.Add(1)
+	go func() {
+		defer w.uploads.Done()
+		w.upload(current, key)
+	}()
+}
+
+// upload - Writes the part to the storage, retrying with backoff while the writer is open
+func (w *Writer) upload(current *part, key string) {
+	logger := log.Instance()
+
+	if err := current.gzip.Close(); err != nil {
+		current.done(fmt.Errorf("%w: %v", ErrPartDropped, err))
+		partsWritten.WithLabelValues("dropped").Inc()
+		logger.Error().
+			Str("Action", "archive").
+			Str("Path", key).
+			Int("Records", current.records).
+			Str("Error", err.Error()).
+			Msg("Error to compress archive part; part dropped")
+		return
+	}
+
+	delay := uploadRetryBaseDelay
+	last_attempt := false
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+		err := w.config.Storage.Write(ctx, key, current.buffer.Bytes())
+		cancel()
+
+		if err == nil {
+			current.done(nil)
+			partsWritten.WithLabelValues("success").Inc()
+			partRecords.Observe(float64(current.records))
+			logger.Info().
+				Str("Action", "archive").
+				Str("Storage", w.config.Storage.String()).
+				Str("Path", key).
+				Int("Records", current.records).
+				Int("Bytes", current.buffer.Len()).
+				Msg("Archive part saved")
+			return
+		}
+
+		if last_attempt {
+			current.done(fmt.Errorf("%w: %v", ErrPartDropped, err))
+			partsWritten.WithLabelValues("dropped").Inc()
+			logger.Error().
+				Str("Action", "archive").
+				Str("Storage", w.config.Storage.String()).
+				Str("Path", key).
+				Int("Records", current.records).
+				Str("Error", err.Error()).
+				Msg("Error to upload archive part on Close; part dropped")
+			return
+		}
+
+		partsWritten.WithLabelValues("failure").Inc()
+		logger.Error().
+			Str("Action", "archive").
+			Str("Storage", w.config.Storage.String()).
+			Str("Path", key).
+			Int("Records", current.records).
+			Dur("Backoff", delay).
+			Str("Error", err.Error()).
+			Msg("Error to upload archive part; retrying")
+
+		select {
+		case <-w.closing:
+			last_attempt = true
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > uploadRetryMaxDelay {
+			delay = uploadRetryMaxDelay
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyStorage - LocalStorage failing the first failures writes
+type flakyStorage struct {
+	LocalStorage
+	mutex    sync.Mutex
+	failures int
+	attempts int
+}
+
+func (s *flakyStorage) Write(ctx context.Context, key string, body []byte) error {
+	s.mutex.Lock()
+	s.attempts++
+	failing := s.attempts <= s.failures
+	s.mutex.Unlock()
+
+	if failing {
+		return errors.New("service unavailable")
+	}
+	return s.LocalStorage.Write(ctx, key, body)
+}
+
+// archived - Ids of the sales in every part written under the partition
+func archived(t *testing.T, storage Storage, partition Partition) []string {
+	keys, err := storage.List(context.Background(), "sales/"+partition.Path()+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, key := range keys {
+		sales, err := Read(context.Background(), storage, Source{Key: key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, sale := range sales {
+			ids = append(ids, sale.ID)
+		}
+	}
+	return ids
+}
+
+func sale(id string) json.RawMessage {
+	return json.RawMessage(`{"id": "` + id + `", "product": "book", "amount": 10}`)
+}
+
+func TestPartition(t *testing.T) {
+	created := time.Date(2026, 10, 19, 23, 30, 0, 0, time.FixedZone("BRT", -3*60*60))
+	if path := PartitionOf(created, "sa-east-1").Path(); path != "year=2026/month=10/day=20/region=sa-east-1" {
+		t.Errorf("got %s", path)
+	}
+}
+
+func TestWriter(t *testing.T) {
+
+	partition := Partition{Year: 2026, Month: 10, Day: 19, Region: "us-east-1"}
+
+	t.Run("Append Reports The Upload", func(t *testing.T) {
+		storage := &LocalStorage{Root: t.TempDir()}
+		writer := New(Config{Prefix: "sales", MaxAge: time.Hour, Storage: storage})
+
+		done, err := writer.Append(partition, sale("1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-done:
+			t.Fatalf("reported %v before the part was flushed", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if ids := archived(t, storage, partition); len(ids) != 0 {
+			t.Errorf("part uploaded before flush: %v", ids)
+		}
+
+		writer.Close()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if ids := archived(t, storage, partition); strings.Join(ids, ",") != "1" {
+			t.Errorf("got %v want [1]", ids)
+		}
+	})
+
+	t.Run("Flush On Max Records", func(t *testing.T) {
+		storage := &LocalStorage{Root: t.TempDir()}
+		writer := New(Config{Prefix: "sales", MaxRecords: 2, MaxAge: time.Hour, Storage: storage})
+		defer writer.Close()
+
+		var waits []<-chan error
+		for _, id := range []string{"1", "2", "3"} {
+			done, err := writer.Append(partition, sale(id))
+			if err != nil {
+				t.Fatal(err)
+			}
+			waits = append(waits, done)
+		}
+
+		for _, done := range waits[:2] {
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		}
+		if ids := archived(t, storage, partition); strings.Join(ids, ",") != "1,2" {
+			t.Errorf("got %v want [1 2]", ids)
+		}
+		if len(waits[2]) != 0 {
+			t.Errorf("sale of the open part reported as uploaded")
+		}
+	})
+
+	t.Run("Flush On Max Age", func(t *testing.T) {
+		storage := &LocalStorage{Root: t.TempDir()}
+		writer := New(Config{Prefix: "sales", MaxAge: 20 * time.Millisecond, Storage: storage})
+
+		stop, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go writer.Run(stop)
+
+		done, err := writer.Append(partition, sale("1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("part not flushed after MaxAge")
+		}
+		if ids := archived(t, storage, partition); strings.Join(ids, ",") != "1" {
+			t.Errorf("got %v want [1]", ids)
+		}
+	})
+
+	t.Run("Failed Upload Retried", func(t *testing.T) {
+		storage := &flakyStorage{LocalStorage: LocalStorage{Root: t.TempDir()}, failures: 1}
+		writer := New(Config{Prefix: "sales", MaxRecords: 1, MaxAge: time.Hour, Storage: storage})
+
+		done, err := writer.Append(partition, sale("1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The retry waits uploadRetryBaseDelay; Close would cut it to a last attempt
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(uploadRetryBaseDelay + 2*time.Second):
+			t.Fatal("failed part not retried")
+		}
+		writer.Close()
+
+		if storage.attempts != 2 {
+			t.Errorf("got %d attempts want 2", storage.attempts)
+		}
+	})
+
+	t.Run("Close Makes A Last Attempt", func(t *testing.T) {
+		storage := &flakyStorage{LocalStorage: LocalStorage{Root: t.TempDir()}, failures: 2}
+		writer := New(Config{Prefix: "sales", MaxAge: time.Hour, Storage: storage})
+
+		done, err := writer.Append(partition, sale("1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		closed := make(chan struct{})
+		go func() {
+			writer.Close()
+			close(closed)
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(uploadRetryBaseDelay / 2):
+			t.Fatal("Close waited for the retry backoff")
+		}
+
+		if storage.attempts != 2 {
+			t.Errorf("got %d attempts want 2", storage.attempts)
+		}
+		if ids := archived(t, storage, partition); len(ids) != 0 {
+			t.Errorf("got %v want the part dropped", ids)
+		}
+		// The message of a dropped sale must stay unacked
+		if err := <-done; !errors.Is(err, ErrPartDropped) {
+			t.Errorf("got %v want %v", err, ErrPartDropped)
+		}
+	})
+
+	t.Run("Append After Close", func(t *testing.T) {
+		writer := New(Config{Prefix: "sales", Storage: &LocalStorage{Root: t.TempDir()}})
+		writer.Close()
+
+		if _, err := writer.Append(partition, sale("1")); !errors.Is(err, ErrClosed) {
+			t.Errorf("got %v want %v", err, ErrClosed)
+		}
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		writer := New(Config{Prefix: "sales", Storage: &LocalStorage{Root: t.TempDir()}})
+		defer writer.Close()
+
+		if _, err := writer.Append(partition, json.RawMessage(`{"id":`)); err == nil {
+			t.Error("expected error for invalid JSON")
+		}
+	})
+
+}
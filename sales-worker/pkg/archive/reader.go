@@ -0,0 +1,105 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sales-worker/models/sales_model"
+)
+
+// Source - One archived object of a day: an NDJSON part or a legacy per-sale JSON object
+type Source struct {
+	Key    string
+	Region string
+	Legacy bool
+}
+
+// Sources - Objects archived for the UTC day sorted by key, so a checkpoint can resume after
+// the last key read: the NDJSON parts under <prefix>/year=YYYY/month=MM/day=DD/region=<region>/
+// and the legacy <prefix>/YYYYMMDD/<id>.json objects, dated by the worker clock and attributed
+// to region. Legacy keys sort before the parts
+func Sources(ctx context.Context, storage Storage, prefix string, region string, day time.Time) ([]Source, error) {
+	var sources []Source
+
+	utc := day.UTC()
+	partition := fmt.Sprintf("%s/year=%04d/month=%02d/day=%02d/", prefix, utc.Year(), int(utc.Month()), utc.Day())
+	keys, err := storage.List(ctx, partition)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".ndjson.gz") {
+			continue
+		}
+
+		source := Source{Key: key, Region: region}
+		if segment := strings.SplitN(strings.TrimPrefix(key, partition), "/", 2)[0]; strings.HasPrefix(segment, "region=") {
+			source.Region = strings.TrimPrefix(segment, "region=")
+		}
+		sources = append(sources, source)
+	}
+
+	keys, err = storage.List(ctx, fmt.Sprintf("%s/%s/", prefix, utc.Format("20060102")))
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if strings.HasSuffix(key, ".json") {
+			sources = append(sources, Source{Key: key, Region: region, Legacy: true})
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Key < sources[j].Key
+	})
+	return sources, nil
+}
+
+// Read - Sales of the archived object
+func Read(ctx context.Context, storage Storage, source Source) ([]sales_model.Model, error) {
+	body, err := storage.Read(ctx, source.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if source.Legacy {
+		var sale sales_model.Model
+		if err := json.Unmarshal(body, &sale); err != nil {
+			return nil, fmt.Errorf("%s: %w", source.Key, err)
+		}
+		return []sales_model.Model{sale}, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source.Key, err)
+	}
+	defer reader.Close()
+
+	var sales []sales_model.Model
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var sale sales_model.Model
+		if err := json.Unmarshal(line, &sale); err != nil {
+			return nil, fmt.Errorf("%s: %w", source.Key, err)
+		}
+		sales = append(sales, sale)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", source.Key, err)
+	}
+	return sales, nil
+}
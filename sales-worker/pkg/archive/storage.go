@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sales-worker/pkg/s3"
+)
+
+// Storage - Object store holding the archive; S3 in production, a local directory for tools
+type Storage interface {
+	List(ctx context.Context, prefix string) ([]string, error)
+	Read(ctx context.Context, key string) ([]byte, error)
+	Write(ctx context.Context, key string, body []byte) error
+	String() string
+}
+
+// OpenStorage - s3://bucket for S3, any other location is a local directory
+func OpenStorage(location string) Storage {
+	if bucket := strings.TrimPrefix(location, "s3://"); bucket != location {
+		return &S3Storage{Bucket: strings.TrimSuffix(bucket, "/")}
+	}
+	return &LocalStorage{Root: location}
+}
+
+// S3Storage - Objects of a bucket
+type S3Storage struct {
+	Bucket string
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+	return s3.ListWithContext(ctx, s.Bucket, prefix)
+}
+
+func (s *S3Storage) Read(ctx context.Context, key string) ([]byte, error) {
+	return s3.GetWithContext(ctx, s.Bucket, key)
+}
+
+func (s *S3Storage) Write(ctx context.Context, key string, body []byte) error {
+	return s3.SaveWithContext(ctx, body, s.Bucket, key)
+}
+
+func (s *S3Storage) String() string {
+	return "s3://" + s.Bucket
+}
+
+// LocalStorage - Files under Root with the object keys as relative paths; runs the tools
+// against a copy of the archive without AWS
+type LocalStorage struct {
+	Root string
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.Root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		relative, err := filepath.Rel(s.Root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(relative); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+
+	sort.Strings(keys)
+	return keys, err
+}
+
+func (s *LocalStorage) Read(ctx context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.Root, filepath.FromSlash(key)))
+}
+
+func (s *LocalStorage) Write(ctx context.Context, key string, body []byte) error {
+	path := filepath.Join(s.Root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, body, 0644)
+}
+
+func (s *LocalStorage) String() string {
+	return s.Root
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"sales-worker/pkg/parameter_store"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ApiKeyHeader = "X-Api-Key"
+
+	ScopeSalesRead   = "sales:read"
+	ScopeSalesWrite  = "sales:write"
+	ScopeSalesDelete = "sales:delete"
+	ScopeAdminSite   = "admin:site"
+
+	MethodAnonymous = "anonymous"
+	MethodApiKey    = "api_key"
+	MethodJWT       = "jwt"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Config - Authentication settings; API keys are stored as SHA-256 hex digests
+type Config struct {
+	Enabled          bool
+	ApiKeys          []ApiKey
+	ApiKeysParameter string
+	JWKSFile         string
+	Issuer           string
+	Audience         string
+}
+
+type ApiKey struct {
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+}
+
+// Principal - Identity resolved from the request credentials
+type Principal struct {
+	Subject string
+	Method  string
+	Scopes  []string
+}
+
+// HasScope - Checks if the principal was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type Authenticator struct {
+	enabled   bool
+	static    []ApiKey
+	parameter string
+	mutex     sync.RWMutex
+	apiKeys   map[string]ApiKey
+	loaded    bool
+	keys      map[string]interface{}
+	issuer    string
+	audience  string
+}
+
+// New - Builds an Authenticator with the API keys from config and SSM, and JWT keys from the JWKS
+// file. Failing to read SSM doesn't fail New: the static keys are served and Ready reports false
+// until a Refresh succeeds, so the API still boots while SSM is unavailable during a failover
+func New(config Config) (*Authenticator, error) {
+	authenticator := &Authenticator{
+		enabled:   config.Enabled,
+		static:    config.ApiKeys,
+		parameter: config.ApiKeysParameter,
+		apiKeys:   make(map[string]ApiKey),
+		keys:      make(map[string]interface{}),
+		issuer:    config.Issuer,
+		audience:  config.Audience,
+	}
+
+	if !config.Enabled {
+		return authenticator, nil
+	}
+
+	authenticator.setApiKeys(nil)
+	authenticator.Refresh()
+
+	if config.JWKSFile != "" {
+		keys, err := LoadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.keys = keys
+	}
+
+	return authenticator, nil
+}
+
+// Refresh - Reloads the API keys stored in SSM; on failure the last known keys stay in use
+func (a *Authenticator) Refresh() error {
+	if !a.enabled || a.parameter == "" {
+		return nil
+	}
+
+	value, err := parameter_store.GetSecureParamValue(a.parameter)
+	if err != nil {
+		return err
+	}
+
+	var stored []ApiKey
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return err
+	}
+
+	a.setApiKeys(stored)
+	return nil
+}
+
+// RefreshEvery - Refreshes the SSM API keys every interval until ctx is cancelled
+func (a *Authenticator) RefreshEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	if !a.enabled || a.parameter == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Refresh(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Ready - False while the SSM API keys were never loaded
+func (a *Authenticator) Ready() bool {
+	if !a.enabled || a.parameter == "" {
+		return true
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.loaded
+}
+
+// setApiKeys - Replaces the keys with the static ones plus stored; nil keeps SSM unloaded
+func (a *Authenticator) setApiKeys(stored []ApiKey) {
+	api_keys := make(map[string]ApiKey, len(a.static)+len(stored))
+	for _, key := range append(append([]ApiKey{}, a.static...), stored...) {
+		api_keys[strings.ToLower(key.Hash)] = key
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.apiKeys = api_keys
+	if stored != nil {
+		a.loaded = true
+	}
+}
+
+// Enabled - Reports if credentials are enforced
+func (a *Authenticator) Enabled() bool {
+	return a.enabled
+}
+
+// Authenticate - Resolves the principal from the X-Api-Key header or an Authorization Bearer token
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if !a.enabled {
+		return &Principal{Subject: MethodAnonymous, Method: MethodAnonymous}, nil
+	}
+
+	if key := r.Header.Get(ApiKeyHeader); key != "" {
+		return a.authenticateApiKey(key)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return a.authenticateJWT(strings.TrimPrefix(authorization, "Bearer "))
+	}
+
+	return nil, ErrMissingCredentials
+}
+
+// HashApiKey - Returns the SHA-256 hex digest stored in place of an API key
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *Authenticator) authenticateApiKey(key string) (*Principal, error) {
+	a.mutex.RLock()
+	api_key, found := a.apiKeys[HashApiKey(key)]
+	a.mutex.RUnlock()
+	if !found {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{
+		Subject: api_key.Name,
+		Method:  MethodApiKey,
+		Scopes:  api_key.Scopes,
+	}, nil
+}
+
+type claims struct {
+	Scope string   `json:"scope"`
+	Scp   []string `json:"scp"`
+	jwt.RegisteredClaims
+}
+
+func (a *Authenticator) authenticateJWT(raw string) (*Principal, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if a.issuer != "" {
+		options = append(options, jwt.WithIssuer(a.issuer))
+	}
+	if a.audience != "" {
+		options = append(options, jwt.WithAudience(a.audience))
+	}
+
+	token_claims := &claims{}
+	_, err := jwt.ParseWithClaims(raw, token_claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, found := a.keys[kid]
+		if !found {
+			return nil, errors.New("unknown signing key")
+		}
+		return key, nil
+	}, options...)
+
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	scopes := token_claims.Scp
+	if token_claims.Scope != "" {
+		scopes = append(scopes, strings.Fields(token_claims.Scope)...)
+	}
+
+	return &Principal{
+		Subject: token_claims.Subject,
+		Method:  MethodJWT,
+		Scopes:  scopes,
+	}, nil
+}
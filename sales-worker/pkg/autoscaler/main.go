@@ -0,0 +1,321 @@
+package autoscaler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"sales-worker/pkg/log"
+	"sales-worker/pkg/resilience"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config - Consumer goroutine bounds and the queue signals that move between them
+type Config struct {
+	MinThreads        int
+	MaxThreads        int
+	Interval          time.Duration
+	MessagesPerThread int
+	MaxMessageAge     time.Duration
+	ScaleUpCooldown   time.Duration
+	ScaleDownCooldown time.Duration
+}
+
+var ErrInvalidBounds = errors.New("thread bounds must satisfy 0 < min <= max")
+
+// Consumer - Consumer goroutine body; it must return once stop is cancelled
+type Consumer func(stop context.Context, thread int)
+
+var (
+	consumerThreads = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sales_worker_consumer_threads",
+		Help: "Consumer goroutines polling the sales queue",
+	})
+
+	queueMessages = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sales_worker_queue_messages",
+		Help: "ApproximateNumberOfMessages of the sales queue at the last autoscaler evaluation",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(consumerThreads, queueMessages)
+}
+
+// Autoscaler - Scales the consumer goroutines with the queue depth and the age of its oldest message
+type Autoscaler struct {
+	config           Config
+	sqsClient        *sqs.SQS
+	cloudwatchClient *cloudwatch.CloudWatch
+	queueURL         string
+	consume          Consumer
+	group            *sync.WaitGroup
+
+	mutex      sync.Mutex
+	stops      []context.CancelFunc
+	last_scale time.Time
+	// next_thread - Id of the next consumer started; ids aren't reused after a scale-in
+	next_thread int
+}
+
+// New - cloudwatchClient may be nil, leaving the queue depth as the only signal
+func New(config Config, sqsClient *sqs.SQS, cloudwatchClient *cloudwatch.CloudWatch, queueURL string, consume Consumer, group *sync.WaitGroup) *Autoscaler {
+	if config.MinThreads <= 0 {
+		config.MinThreads = 1
+	}
+	if config.MaxThreads < config.MinThreads {
+		config.MaxThreads = config.MinThreads
+	}
+	if config.MessagesPerThread <= 0 {
+		config.MessagesPerThread = 1
+	}
+
+	return &Autoscaler{
+		config:           config,
+		sqsClient:        sqsClient,
+		cloudwatchClient: cloudwatchClient,
+		queueURL:         queueURL,
+		consume:          consume,
+		group:            group,
+	}
+}
+
+// Threads - Consumer goroutines running
+func (a *Autoscaler) Threads() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return len(a.stops)
+}
+
+// Bounds - Current minimum and maximum consumer threads
+func (a *Autoscaler) Bounds() (int, int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.config.MinThreads, a.config.MaxThreads
+}
+
+// Resize - Changes the thread bounds at runtime and moves the running threads into them right away
+func (a *Autoscaler) Resize(stop context.Context, min_threads int, max_threads int) error {
+	if min_threads <= 0 || max_threads < min_threads {
+		return ErrInvalidBounds
+	}
+
+	a.mutex.Lock()
+	a.config.MinThreads = min_threads
+	a.config.MaxThreads = max_threads
+	current := len(a.stops)
+	a.mutex.Unlock()
+
+	if current < min_threads {
+		a.scaleTo(stop, min_threads)
+	}
+	if current > max_threads {
+		a.scaleTo(stop, max_threads)
+	}
+	return nil
+}
+
+// Run - Starts MinThreads consumers and evaluates the queue every Interval until stop is cancelled
+func (a *Autoscaler) Run(stop context.Context) {
+	a.scaleTo(stop, a.config.MinThreads)
+
+	if a.config.Interval <= 0 {
+		<-stop.Done()
+		return
+	}
+
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop.Done():
+			return
+		case <-ticker.C:
+			a.evaluate(stop)
+		}
+	}
+}
+
+func (a *Autoscaler) evaluate(stop context.Context) {
+	log := log.Instance()
+
+	messages, oldest, err := a.queueSignals(stop)
+	if err != nil {
+		log.Error().
+			Str("Action", "autoscale").
+			Str("Error", err.Error()).
+			Msg("Error to read queue attributes")
+		return
+	}
+
+	queueMessages.Set(float64(messages))
+
+	// Fixed thread count: nothing to decide
+	if min_threads, max_threads := a.Bounds(); min_threads == max_threads {
+		return
+	}
+
+	current := a.Threads()
+	desired := a.Desired(current, messages, oldest)
+	if desired == current {
+		return
+	}
+
+	a.mutex.Lock()
+	since := time.Since(a.last_scale)
+	a.mutex.Unlock()
+
+	if desired > current && since < a.config.ScaleUpCooldown {
+		return
+	}
+	if desired < current {
+		if since < a.config.ScaleDownCooldown {
+			return
+		}
+		// One consumer at a time; each one finishes its batch before leaving
+		desired = current - 1
+	}
+
+	log.Info().
+		Str("Action", "autoscale").
+		Int("Messages", messages).
+		Dur("OldestMessageAge", oldest).
+		Int("From", current).
+		Int("To", desired).
+		Msg("Scaling consumer threads")
+
+	a.scaleTo(stop, desired)
+}
+
+// Desired - One thread per MessagesPerThread visible messages within the bounds; an oldest
+// message past MaxMessageAge asks for one more thread than running
+func (a *Autoscaler) Desired(current int, messages int, oldest time.Duration) int {
+	desired := int(math.Ceil(float64(messages) / float64(a.config.MessagesPerThread)))
+
+	if a.config.MaxMessageAge > 0 && oldest > a.config.MaxMessageAge && desired <= current {
+		desired = current + 1
+	}
+
+	min_threads, max_threads := a.Bounds()
+	if desired < min_threads {
+		return min_threads
+	}
+	if desired > max_threads {
+		return max_threads
+	}
+	return desired
+}
+
+func (a *Autoscaler) scaleTo(stop context.Context, threads int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for len(a.stops) < threads {
+		thread := a.next_thread
+		a.next_thread++
+		consumer_stop, cancel := context.WithCancel(stop)
+		a.stops = append(a.stops, cancel)
+
+		a.group.Add(1)
+		go func() {
+			defer a.group.Done()
+			a.consume(consumer_stop, thread)
+		}()
+	}
+
+	for len(a.stops) > threads {
+		last := len(a.stops) - 1
+		a.stops[last]()
+		a.stops = a.stops[:last]
+	}
+
+	a.last_scale = time.Now()
+	consumerThreads.Set(float64(len(a.stops)))
+}
+
+// queueSignals - Visible messages from GetQueueAttributes and the age of the oldest message. The
+// age isn't a queue attribute; SQS only publishes it as the ApproximateAgeOfOldestMessage
+// CloudWatch metric, so it is read from there and lags by up to a minute
+func (a *Autoscaler) queueSignals(ctx context.Context) (int, time.Duration, error) {
+	var result *sqs.GetQueueAttributesOutput
+	err := resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		var err error
+		result, err = a.sqsClient.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(a.queueURL),
+			AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameApproximateNumberOfMessages}),
+		})
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	messages, _ := strconv.Atoi(aws.StringValue(result.Attributes[sqs.QueueAttributeNameApproximateNumberOfMessages]))
+
+	if a.config.MaxMessageAge <= 0 {
+		return messages, 0, nil
+	}
+
+	oldest, err := a.OldestMessageAge(ctx)
+	if err != nil {
+		// Depth alone still drives the scaling
+		logger := log.Instance()
+		logger.Warn().
+			Str("Action", "autoscale").
+			Str("Error", err.Error()).
+			Msg("Error to read ApproximateAgeOfOldestMessage from CloudWatch")
+		return messages, 0, nil
+	}
+
+	return messages, oldest, nil
+}
+
+// OldestMessageAge - ApproximateAgeOfOldestMessage of the queue from CloudWatch; zero without
+// a CloudWatch client or datapoints. Also the backlog source of the SLO, autoscaling or not
+func (a *Autoscaler) OldestMessageAge(ctx context.Context) (time.Duration, error) {
+	if a.cloudwatchClient == nil {
+		return 0, nil
+	}
+
+	now := time.Now()
+	var statistics *cloudwatch.GetMetricStatisticsOutput
+	err := resilience.Call(ctx, resilience.CloudWatch, func(ctx context.Context) error {
+		var err error
+		statistics, err = a.cloudwatchClient.GetMetricStatisticsWithContext(ctx, &cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String("AWS/SQS"),
+			MetricName: aws.String("ApproximateAgeOfOldestMessage"),
+			Dimensions: []*cloudwatch.Dimension{
+				{Name: aws.String("QueueName"), Value: aws.String(path.Base(a.queueURL))},
+			},
+			StartTime:  aws.Time(now.Add(-5 * time.Minute)),
+			EndTime:    aws.Time(now),
+			Period:     aws.Int64(60),
+			Statistics: aws.StringSlice([]string{cloudwatch.StatisticMaximum}),
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var latest *cloudwatch.Datapoint
+	for _, datapoint := range statistics.Datapoints {
+		if latest == nil || datapoint.Timestamp.After(*latest.Timestamp) {
+			latest = datapoint
+		}
+	}
+	if latest == nil {
+		return 0, nil
+	}
+
+	return time.Duration(aws.Float64Value(latest.Maximum)) * time.Second, nil
+}
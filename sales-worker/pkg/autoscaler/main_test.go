@@ -0,0 +1,78 @@
+package autoscaler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScaleTo(t *testing.T) {
+
+	var (
+		mutex   sync.Mutex
+		started []int
+		group   sync.WaitGroup
+	)
+
+	consume := func(stop context.Context, thread int) {
+		mutex.Lock()
+		started = append(started, thread)
+		mutex.Unlock()
+		<-stop.Done()
+	}
+
+	stop, cancel := context.WithCancel(context.Background())
+	a := New(Config{MinThreads: 1, MaxThreads: 5}, nil, nil, "", consume, &group)
+
+	a.scaleTo(stop, 3)
+	a.scaleTo(stop, 1)
+	a.scaleTo(stop, 3)
+
+	if threads := a.Threads(); threads != 3 {
+		t.Errorf("got %d threads want 3", threads)
+	}
+
+	cancel()
+	group.Wait()
+
+	seen := map[int]bool{}
+	for _, thread := range started {
+		if seen[thread] {
+			t.Errorf("thread id %d reused after scaling in", thread)
+		}
+		seen[thread] = true
+	}
+	if len(started) != 5 {
+		t.Errorf("got %d consumers started want 5", len(started))
+	}
+
+}
+
+func TestDesired(t *testing.T) {
+
+	a := New(Config{MinThreads: 2, MaxThreads: 6, MessagesPerThread: 10, MaxMessageAge: time.Minute}, nil, nil, "", nil, &sync.WaitGroup{})
+
+	tests := map[string]struct {
+		current int
+		visible int
+		oldest  time.Duration
+		want    int
+	}{
+		"Empty Queue":        {2, 0, 0, 2},
+		"Within Bounds":      {2, 40, 0, 4},
+		"Above Max":          {2, 1000, 0, 6},
+		"Old Message":        {3, 20, 2 * time.Minute, 4},
+		"Old Message At Max": {6, 20, 2 * time.Minute, 6},
+		"Young Message":      {3, 20, 30 * time.Second, 2},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := a.Desired(test.current, test.visible, test.oldest); got != test.want {
+				t.Errorf("got %d want %d", got, test.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	EventTypeAttribute    = "event_type"
+	ProductAttribute      = "product"
+	SourceRegionAttribute = "source_region"
+	SiteStateAttribute    = "site_state"
+)
+
+// Attributes - Filterable metadata of an event, usable in SNS subscription filter policies
+type Attributes struct {
+	EventType    string
+	Product      string
+	SourceRegion string
+	SiteState    string
+}
+
+// SetEventAttributes - Adds the filterable attributes to the message; in CloudEvents binary
+// mode the type and region already travel as ce_type and ce_source, so they are not repeated
+// to keep the message under the SNS limit of 10 attributes
+func (m *Message) SetEventAttributes(attributes Attributes) {
+	if m.Attributes == nil {
+		m.Attributes = make(map[string]string)
+	}
+
+	set := func(name string, value string) {
+		if value != "" {
+			m.Attributes[name] = value
+		}
+	}
+
+	if _, binary := m.Attributes[cloudEventsAttributePrefix+"type"]; !binary {
+		set(EventTypeAttribute, attributes.EventType)
+		set(SourceRegionAttribute, attributes.SourceRegion)
+	}
+	set(ProductAttribute, attributes.Product)
+	set(SiteStateAttribute, attributes.SiteState)
+}
+
+// EventAttributes - Reads the filterable attributes of a received message, falling back
+// to the CloudEvents binary attributes; fields are empty when the publisher did not send them
+func (m *Message) EventAttributes() Attributes {
+	attributes := Attributes{
+		EventType:    m.Attributes[EventTypeAttribute],
+		Product:      m.Attributes[ProductAttribute],
+		SourceRegion: m.Attributes[SourceRegionAttribute],
+		SiteState:    m.Attributes[SiteStateAttribute],
+	}
+
+	if attributes.EventType == "" {
+		attributes.EventType = m.Attributes[cloudEventsAttributePrefix+"type"]
+	}
+
+	if ce_source, found := m.Attributes[cloudEventsAttributePrefix+"source"]; found && attributes.SourceRegion == "" {
+		attributes.SourceRegion = strings.TrimPrefix(ce_source, source(""))
+	}
+
+	return attributes
+}
+
+// DeduplicationId - Derives a stable deduplication id so FIFO retries of the same event of a sale are dropped
+func DeduplicationId(id string, event_type string) string {
+	sum := sha256.Sum256([]byte(id + ":" + event_type))
+	return hex.EncodeToString(sum[:])
+}
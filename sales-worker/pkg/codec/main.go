@@ -0,0 +1,89 @@
+package codec
+
+import (
+	"fmt"
+
+	"sales-worker/pkg/events"
+)
+
+const (
+	JSON                  = "json"
+	CloudEventsStructured = "cloudevents-structured"
+	CloudEventsBinary     = "cloudevents-binary"
+	Protobuf              = "protobuf"
+
+	// ContentTypeAttribute - Message attribute advertising the encoding of the body
+	ContentTypeAttribute = "content-type"
+)
+
+// Message - Transport representation of an event: the body, its message attributes and
+// the ordering keys used by FIFO topics and queues
+type Message struct {
+	Body            string
+	Attributes      map[string]string
+	GroupId         string
+	DeduplicationId string
+}
+
+// Codec - Converts envelopes to transport messages and back; Decode returns the
+// envelope as a JSON document so it can be validated against the event schemas
+type Codec interface {
+	ContentType() string
+	Encode(event *events.Envelope) (*Message, error)
+	Decode(message *Message) ([]byte, error)
+}
+
+// Get - Returns the codec selected by the encoding name used in config
+func Get(encoding string) (Codec, error) {
+	switch encoding {
+	case "", JSON:
+		return jsonCodec{}, nil
+	case CloudEventsStructured:
+		return cloudEventsStructuredCodec{}, nil
+	case CloudEventsBinary:
+		return cloudEventsBinaryCodec{}, nil
+	case Protobuf:
+		return protobufCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown event encoding %q", encoding)
+	}
+}
+
+// ForMessage - Picks the codec of a received message from its attributes;
+// messages without a content-type are plain JSON
+func ForMessage(message *Message) Codec {
+	if _, found := message.Attributes[cloudEventsAttributePrefix+"specversion"]; found {
+		return cloudEventsBinaryCodec{}
+	}
+
+	switch message.Attributes[ContentTypeAttribute] {
+	case cloudEventsContentType:
+		return cloudEventsStructuredCodec{}
+	case protobufContentType:
+		return protobufCodec{}
+	default:
+		return jsonCodec{}
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return jsonContentType
+}
+
+func (c jsonCodec) Encode(event *events.Envelope) (*Message, error) {
+	body, err := marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Body:       string(body),
+		Attributes: map[string]string{ContentTypeAttribute: c.ContentType()},
+	}, nil
+}
+
+func (jsonCodec) Decode(message *Message) ([]byte, error) {
+	return []byte(message.Body), nil
+}
@@ -0,0 +1,188 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"sales-worker/pkg/events"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestProtobufDecode(t *testing.T) {
+
+	event := &events.Envelope{
+		Type:          events.SaleCreated,
+		SchemaVersion: 2,
+		EventID:       "2f9c3a5e",
+		SourceRegion:  "sa-east-1",
+		OccurredAt:    time.Unix(1689033600, 0).UTC(),
+		Data:          json.RawMessage(`{"id":"2f9c3a5e","product":"teste","amount":223.34,"sale_processed":false,"timestamp":1689033600}`),
+	}
+
+	t.Run("Round Trip", func(t *testing.T) {
+		message, err := protobufCodec{}.Encode(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		document, err := ForMessage(message).Decode(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded events.Envelope
+		if err := json.Unmarshal(document, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.EventID != event.EventID || decoded.SourceRegion != event.SourceRegion || !decoded.OccurredAt.Equal(event.OccurredAt) {
+			t.Errorf("got %+v want %+v", decoded, event)
+		}
+	})
+
+	tag := protowire.AppendTag
+
+	malformed := map[string]struct {
+		raw  []byte
+		want error
+	}{
+		"Varint Type Field": {
+			raw:  protowire.AppendVarint(tag(nil, 1, protowire.VarintType), 7),
+			want: ErrWireType,
+		},
+		"Bytes Schema Version": {
+			raw:  protowire.AppendString(tag(nil, 2, protowire.BytesType), "2"),
+			want: ErrWireType,
+		},
+		"Varint Occurred At": {
+			raw:  protowire.AppendVarint(tag(nil, 5, protowire.VarintType), 1689033600),
+			want: ErrWireType,
+		},
+		"Fixed64 Sale": {
+			raw:  protowire.AppendFixed64(tag(nil, 6, protowire.Fixed64Type), 1),
+			want: ErrWireType,
+		},
+		"Bytes Sale Amount": {
+			raw:  protowire.AppendBytes(tag(nil, 6, protowire.BytesType), protowire.AppendString(tag(nil, 3, protowire.BytesType), "223.34")),
+			want: ErrWireType,
+		},
+		"Varint Sale Amount": {
+			raw:  protowire.AppendBytes(tag(nil, 6, protowire.BytesType), protowire.AppendVarint(tag(nil, 3, protowire.VarintType), 223)),
+			want: ErrWireType,
+		},
+		"Fixed64 Sale Timestamp": {
+			raw:  protowire.AppendBytes(tag(nil, 6, protowire.BytesType), protowire.AppendFixed64(tag(nil, 5, protowire.Fixed64Type), 1689033600)),
+			want: ErrWireType,
+		},
+		"Fixed64 Schema Version": {
+			raw:  protowire.AppendFixed64(tag(nil, 2, protowire.Fixed64Type), 2),
+			want: ErrWireType,
+		},
+		"Truncated Field": {
+			raw: append(tag(nil, 1, protowire.BytesType), 10, 'a'),
+		},
+	}
+
+	for name, test := range malformed {
+		t.Run("Malformed "+name, func(t *testing.T) {
+			message := &Message{
+				Body:       base64.StdEncoding.EncodeToString(test.raw),
+				Attributes: map[string]string{ContentTypeAttribute: protobufContentType},
+			}
+
+			_, err := ForMessage(message).Decode(message)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Errorf("got %v want %v", err, test.want)
+			}
+		})
+	}
+
+	t.Run("Malformed Base64", func(t *testing.T) {
+		message := &Message{Body: "%%%", Attributes: map[string]string{ContentTypeAttribute: protobufContentType}}
+		if _, err := ForMessage(message).Decode(message); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+}
+
+func TestEventAttributes(t *testing.T) {
+
+	event := &events.Envelope{
+		Type:          events.SaleCreated,
+		SchemaVersion: 1,
+		EventID:       "2f9c3a5e",
+		SourceRegion:  "sa-east-1",
+		OccurredAt:    time.Unix(1689033600, 0).UTC(),
+		Data:          json.RawMessage(`{"id":"2f9c3a5e"}`),
+	}
+
+	attributes := Attributes{
+		EventType:    event.Type,
+		Product:      "teste",
+		SourceRegion: event.SourceRegion,
+		SiteState:    "active",
+	}
+
+	tests := []struct {
+		encoding string
+		absent   []string
+	}{
+		{encoding: JSON},
+		{encoding: CloudEventsStructured},
+		// ce_type and ce_source already carry the type and region
+		{encoding: CloudEventsBinary, absent: []string{EventTypeAttribute, SourceRegionAttribute}},
+		{encoding: Protobuf},
+	}
+
+	for _, test := range tests {
+		t.Run("Attributes "+test.encoding, func(t *testing.T) {
+			encoder, err := Get(test.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message, err := encoder.Encode(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message.SetEventAttributes(attributes)
+
+			for _, name := range test.absent {
+				if _, found := message.Attributes[name]; found {
+					t.Errorf("unexpected attribute %s in %v", name, message.Attributes)
+				}
+			}
+			// SNS and SQS deliver at most 10 message attributes
+			if len(message.Attributes) > 10 {
+				t.Errorf("got %d attributes want at most 10", len(message.Attributes))
+			}
+
+			if got := message.EventAttributes(); got != attributes {
+				t.Errorf("got %+v want %+v", got, attributes)
+			}
+		})
+	}
+
+	t.Run("Attributes Missing", func(t *testing.T) {
+		message := &Message{Body: "{}", Attributes: map[string]string{ProductAttribute: "teste"}}
+		if got := message.EventAttributes(); got != (Attributes{Product: "teste"}) {
+			t.Errorf("got %+v want only the product", got)
+		}
+	})
+
+	t.Run("Deduplication Id", func(t *testing.T) {
+		if DeduplicationId("2f9c3a5e", events.SaleCreated) != DeduplicationId("2f9c3a5e", events.SaleCreated) {
+			t.Errorf("deduplication id should be stable")
+		}
+		if DeduplicationId("2f9c3a5e", events.SaleCreated) == DeduplicationId("2f9c3a5e", "sale.deleted") {
+			t.Errorf("events of another type should not be deduplicated")
+		}
+	})
+
+}
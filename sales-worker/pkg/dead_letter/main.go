@@ -0,0 +1,113 @@
+package dead_letter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"sales-worker/pkg/resilience"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Error details sent as message attributes to the dead-letter queue
+const (
+	ErrorAttribute        = "error"
+	ErrorKindAttribute    = "error_kind"
+	SourceQueueAttribute  = "source_queue"
+	ReceiveCountAttribute = "receive_count"
+	OriginalAttributes    = "original_attributes"
+)
+
+var ErrNotConfigured = errors.New("no dead-letter queue or quarantine table configured")
+
+// Record - Failed message with its error details
+type Record struct {
+	MessageId    string            `dynamodbav:"id" json:"id"`
+	Body         string            `dynamodbav:"body" json:"body"`
+	Attributes   map[string]string `dynamodbav:"attributes" json:"attributes"`
+	SourceQueue  string            `dynamodbav:"source_queue" json:"source_queue"`
+	Error        string            `dynamodbav:"error" json:"error"`
+	ErrorKind    string            `dynamodbav:"error_kind" json:"error_kind"`
+	ReceiveCount int               `dynamodbav:"receive_count" json:"receive_count"`
+	FailedAt     int64             `dynamodbav:"failed_at" json:"failed_at"`
+}
+
+// Send - Moves the record to SQS_SALES_DLQ, or to DYNAMO_SALES_QUARANTINE_TABLE when no DLQ is set
+func Send(ctx context.Context, record Record) error {
+	if record.FailedAt == 0 {
+		record.FailedAt = time.Now().Unix()
+	}
+
+	if queue := os.Getenv("SQS_SALES_DLQ"); queue != "" {
+		return sendToQueue(ctx, queue, record)
+	}
+
+	if table := os.Getenv("DYNAMO_SALES_QUARANTINE_TABLE"); table != "" {
+		return putOnTable(ctx, table, record)
+	}
+
+	return ErrNotConfigured
+}
+
+func sendToQueue(ctx context.Context, queue string, record Record) error {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
+	if err != nil {
+		return err
+	}
+	svc := sqs.New(sess)
+
+	// Original attributes travel as one JSON attribute to stay within the SQS limit of 10
+	original, err := json.Marshal(record.Attributes)
+	if err != nil {
+		return err
+	}
+
+	attributes := make(map[string]*sqs.MessageAttributeValue, 5)
+	attributes[OriginalAttributes] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(string(original))}
+	attributes[ErrorAttribute] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(record.Error)}
+	attributes[ErrorKindAttribute] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(record.ErrorKind)}
+	attributes[SourceQueueAttribute] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(record.SourceQueue)}
+	attributes[ReceiveCountAttribute] = &sqs.MessageAttributeValue{DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(record.ReceiveCount))}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(queue),
+		MessageBody:       aws.String(record.Body),
+		MessageAttributes: attributes,
+	}
+
+	return resilience.Call(ctx, resilience.SQS, func(ctx context.Context) error {
+		_, err := svc.SendMessageWithContext(ctx, input)
+		return err
+	})
+}
+
+func putOnTable(ctx context.Context, table string, record Record) error {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
+	if err != nil {
+		return err
+	}
+	svc := dynamodb.New(sess)
+
+	item, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item:      item,
+	}
+
+	return resilience.Call(ctx, resilience.DynamoDB, func(ctx context.Context) error {
+		_, err := svc.PutItemWithContext(ctx, input)
+		return err
+	})
+}
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	SaleCreated = "sale.created"
+
+	// LegacyVersion - Schema version assigned to bare sale messages published before the envelope
+	LegacyVersion = 0
+)
+
+var ErrUnsupportedEvent = errors.New("unsupported event")
+
+// Envelope - Versioned wrapper of every sale event
+type Envelope struct {
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	EventID       string          `json:"event_id"`
+	SourceRegion  string          `json:"source_region"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+//go:embed schemas/*.json
+var files embed.FS
+
+// schemas - Compiled JSON Schemas indexed by event type and schema version
+var schemas = map[string]map[int]*jsonschema.Schema{
+	SaleCreated: {
+		LegacyVersion: compile("sale.v0.json"),
+		1:             compile("sale.created.v1.json"),
+	},
+}
+
+func compile(name string) *jsonschema.Schema {
+	content, err := files.ReadFile("schemas/" + name)
+	if err != nil {
+		panic(err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	if err := compiler.AddResource(name, bytes.NewReader(content)); err != nil {
+		panic(err)
+	}
+	return compiler.MustCompile(name)
+}
+
+// Decode - Validates a message against its schema and returns the envelope;
+// bare sale messages are accepted and wrapped as legacy sale.created events
+func Decode(message []byte) (*Envelope, error) {
+	var document interface{}
+	if err := json.Unmarshal(message, &document); err != nil {
+		return nil, err
+	}
+
+	fields, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: message is not a JSON object", ErrUnsupportedEvent)
+	}
+
+	if _, found := fields["type"]; !found {
+		return decodeLegacy(message, document)
+	}
+
+	var header struct {
+		Type          string `json:"type"`
+		SchemaVersion int    `json:"schema_version"`
+	}
+	if err := json.Unmarshal(message, &header); err != nil {
+		return nil, err
+	}
+
+	schema, found := schemas[header.Type][header.SchemaVersion]
+	if !found {
+		return nil, fmt.Errorf("%w: %s version %d", ErrUnsupportedEvent, header.Type, header.SchemaVersion)
+	}
+
+	if err := schema.Validate(document); err != nil {
+		return nil, err
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return nil, err
+	}
+
+	return &envelope, nil
+}
+
+func decodeLegacy(message []byte, document interface{}) (*Envelope, error) {
+	if err := schemas[SaleCreated][LegacyVersion].Validate(document); err != nil {
+		return nil, err
+	}
+
+	var sale struct {
+		ID        string `json:"id"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(message, &sale); err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		Type:          SaleCreated,
+		SchemaVersion: LegacyVersion,
+		EventID:       sale.ID,
+		OccurredAt:    time.Unix(sale.Timestamp, 0).UTC(),
+		Data:          json.RawMessage(message),
+	}, nil
+}
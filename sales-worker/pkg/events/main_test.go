@@ -0,0 +1,99 @@
+package events_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"sales-worker/pkg/events"
+	"sales-worker/pkg/failure"
+)
+
+func TestDecode(t *testing.T) {
+
+	t.Run("Valid V1 Envelope", func(t *testing.T) {
+		message := []byte(`{"type":"sale.created","schema_version":1,"event_id":"2f9c3a5e","source_region":"sa-east-1",` +
+			`"occurred_at":"2023-07-11T00:00:00Z","data":{"id":"2f9c3a5e","product":"teste","amount":223.34,"timestamp":1689033600}}`)
+
+		event, err := events.Decode(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != events.SaleCreated || event.SchemaVersion != 1 || event.EventID != "2f9c3a5e" ||
+			event.SourceRegion != "sa-east-1" || !event.OccurredAt.Equal(time.Unix(1689033600, 0)) {
+			t.Errorf("unexpected envelope %+v", event)
+		}
+
+		var sale struct {
+			ID     string  `json:"id"`
+			Amount float64 `json:"amount"`
+		}
+		if err := json.Unmarshal(event.Data, &sale); err != nil {
+			t.Fatal(err)
+		}
+		if sale.ID != "2f9c3a5e" || sale.Amount != 223.34 {
+			t.Errorf("unexpected data %s", event.Data)
+		}
+	})
+
+	t.Run("Legacy Bare Sale", func(t *testing.T) {
+		message := []byte(`{"id":"2f9c3a5e","product":"teste","amount":223.34,"sale_processed":false,"timestamp":1689033600}`)
+
+		event, err := events.Decode(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != events.SaleCreated || event.SchemaVersion != events.LegacyVersion || event.EventID != "2f9c3a5e" ||
+			!event.OccurredAt.Equal(time.Unix(1689033600, 0)) || string(event.Data) != string(message) {
+			t.Errorf("unexpected envelope %+v", event)
+		}
+	})
+
+	rejected := map[string]struct {
+		message string
+		want    error
+	}{
+		"Wrong Schema Version": {
+			message: `{"type":"sale.created","schema_version":9,"event_id":"2f9c3a5e","source_region":"sa-east-1",` +
+				`"occurred_at":"2023-07-11T00:00:00Z","data":{"id":"2f9c3a5e","product":"teste","amount":223.34,"timestamp":1689033600}}`,
+			want: events.ErrUnsupportedEvent,
+		},
+		"Unknown Type": {
+			message: `{"type":"sale.deleted","schema_version":1}`,
+			want:    events.ErrUnsupportedEvent,
+		},
+		"Schema Violation": {
+			message: `{"type":"sale.created","schema_version":1,"event_id":"2f9c3a5e","source_region":"sa-east-1",` +
+				`"occurred_at":"2023-07-11T00:00:00Z","data":{"id":"2f9c3a5e","product":"teste","amount":"223.34","timestamp":1689033600}}`,
+		},
+		"Invalid Occurred At": {
+			message: `{"type":"sale.created","schema_version":1,"event_id":"2f9c3a5e","source_region":"sa-east-1",` +
+				`"occurred_at":"yesterday","data":{"id":"2f9c3a5e","product":"teste","amount":223.34,"timestamp":1689033600}}`,
+		},
+		"Legacy Sale Without Product": {
+			message: `{"id":"2f9c3a5e","amount":223.34,"timestamp":1689033600}`,
+		},
+		"Not An Object": {
+			message: `["2f9c3a5e"]`,
+			want:    events.ErrUnsupportedEvent,
+		},
+	}
+
+	for name, test := range rejected {
+		t.Run("Rejects "+name, func(t *testing.T) {
+			_, err := events.Decode([]byte(test.message))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Errorf("got %v want %v", err, test.want)
+			}
+			// Redelivering an invalid event never fixes it
+			if kind := failure.Classify(err); kind != failure.Permanent {
+				t.Errorf("got %v want %v", kind, failure.Permanent)
+			}
+		})
+	}
+
+}
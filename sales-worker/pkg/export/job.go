@@ -0,0 +1,163 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"sales-worker/models/sales_model"
+	"sales-worker/pkg/log"
+)
+
+const (
+	// retryInterval - Wait before exporting a failed day again
+	retryInterval = 15 * time.Minute
+	// retryWindow - Failed days are retried until they are this old; later runs only log them
+	retryWindow = 7 * 24 * time.Hour
+
+	// lockLease - How long a replica holds a day; a crashed replica's day is taken over after it
+	lockLease = time.Hour
+	// lockTTL - How long the completed claim of a day keeps the other replicas from exporting it
+	lockTTL = 30 * 24 * time.Hour
+)
+
+// Lock - Claims of the scheduled days, so each day is exported by one replica; the sales
+// idempotency table satisfies it with export#YYYY-MM-DD ids
+type Lock interface {
+	ClaimIdempotencyWithContext(ctx context.Context, id string, owner string, lease time.Duration, ttl time.Duration) error
+	CompleteIdempotencyWithContext(ctx context.Context, id string, owner string, ttl time.Duration) error
+	ReleaseIdempotencyWithContext(ctx context.Context, id string, owner string) error
+}
+
+// Schedule - Exports the previous UTC day every day at offset past midnight, leaving time for
+// the last archive parts of the day to be written. Failed days are retried every
+// retryInterval; returns when stop is cancelled
+func Schedule(stop context.Context, config Config, offset time.Duration) {
+	ctx := log.WithContext(stop, log.Instance().With().Str("Action", "export").Logger())
+	log := log.FromContext(ctx)
+
+	owner := lockOwner()
+	var pending []time.Time
+
+	for {
+		next := nextRun(time.Now(), offset)
+		wait := time.Until(next)
+		if len(pending) > 0 && retryInterval < wait {
+			wait = retryInterval
+		}
+
+		log.Info().
+			Time("NextRun", next).
+			Int("Pending", len(pending)).
+			Msg("Parquet export scheduled")
+
+		select {
+		case <-stop.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if !time.Now().Before(next) {
+			pending = append(pending, next.Add(-offset).AddDate(0, 0, -1))
+		}
+		pending = exportPending(ctx, config, owner, pending, time.Now())
+	}
+}
+
+// exportPending - Exports the pending days and returns the ones to retry: failed days and
+// days held by another replica, until they leave the retry window
+func exportPending(ctx context.Context, config Config, owner string, pending []time.Time, now time.Time) []time.Time {
+	log := log.FromContext(ctx)
+
+	var retry []time.Time
+	for _, day := range pending {
+		err := exportScheduled(ctx, config, owner, day)
+
+		switch {
+		case err == nil, errors.Is(err, sales_model.ErrAlreadyProcessed):
+			continue
+		case now.Sub(day) > retryWindow:
+			log.Error().
+				Str("Date", day.Format(dateLayout)).
+				Str("Error", err.Error()).
+				Msg("Parquet export failed past its retry window; run cmd/export for the day")
+			continue
+		case errors.Is(err, sales_model.ErrClaimedByOther):
+			log.Info().
+				Str("Date", day.Format(dateLayout)).
+				Msg("Parquet export of the day held by another replica")
+		default:
+			log.Error().
+				Str("Date", day.Format(dateLayout)).
+				Str("Error", err.Error()).
+				Dur("Retry", retryInterval).
+				Msg("Error to export sales to Parquet")
+		}
+		retry = append(retry, day)
+	}
+	return retry
+}
+
+// exportScheduled - Exports the day under its claim; ErrAlreadyProcessed when another replica
+// exported it and ErrClaimedByOther while one is exporting it
+func exportScheduled(ctx context.Context, config Config, owner string, day time.Time) error {
+	log := log.FromContext(ctx)
+	id := "export#" + day.Format(dateLayout)
+
+	if config.Lock != nil {
+		if err := config.Lock.ClaimIdempotencyWithContext(ctx, id, owner, lockLease, lockTTL); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := Run(ctx, config, day, day)
+	if err != nil {
+		if config.Lock != nil {
+			// Lets the next retry, here or in another replica, claim the day right away
+			if release_err := config.Lock.ReleaseIdempotencyWithContext(ctx, id, owner); release_err != nil {
+				log.Warn().
+					Str("Date", day.Format(dateLayout)).
+					Str("Error", release_err.Error()).
+					Msg("Error to release the export claim; retries wait for the lease")
+			}
+		}
+		return err
+	}
+
+	if config.Lock != nil {
+		if err := config.Lock.CompleteIdempotencyWithContext(ctx, id, owner, lockTTL); err != nil {
+			// The files are written; another replica may export the day again once the lease expires
+			log.Warn().
+				Str("Date", day.Format(dateLayout)).
+				Str("Error", err.Error()).
+				Msg("Error to complete the export claim")
+		}
+	}
+
+	log.Info().
+		Str("Date", day.Format(dateLayout)).
+		Int("Files", len(manifest.Files)).
+		Int("Records", manifest.Records).
+		Msg("Parquet export finished")
+	return nil
+}
+
+// lockOwner - Identifies the replica in the day claims, like the consumers in the sale claims
+func lockOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
+
+// nextRun - Next midnight UTC plus offset after now
+func nextRun(now time.Time, offset time.Duration) time.Time {
+	next := truncateDay(now).Add(offset)
+	if !next.After(now) {
+		next = truncateDay(now).AddDate(0, 0, 1).Add(offset)
+	}
+	return next
+}
@@ -0,0 +1,250 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"sales-worker/models/sales_model"
+	"sales-worker/pkg/archive"
+	"sales-worker/pkg/log"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Row - Parquet schema of the exported sales. The worker archives a sale once it is processed,
+// so processed is true for every archived sale; the flag in the body is its value at creation
+type Row struct {
+	ID        string  `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Product   string  `parquet:"name=product, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Amount    float64 `parquet:"name=amount, type=DOUBLE"`
+	Timestamp int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Processed bool    `parquet:"name=processed, type=BOOLEAN"`
+	Region    string  `parquet:"name=region, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+// Schema - Columns of Row, recorded in the manifest
+var Schema = []Column{
+	{Name: "id", Type: "string"},
+	{Name: "product", Type: "string"},
+	{Name: "amount", Type: "double"},
+	{Name: "timestamp", Type: "timestamp_millis"},
+	{Name: "processed", Type: "boolean"},
+	{Name: "region", Type: "string"},
+}
+
+// Config - Where the archive is read from and the Parquet files are written to
+type Config struct {
+	Source      archive.Storage
+	Destination archive.Storage
+	// ArchivePrefix - Prefix of the NDJSON parts and of the legacy sales/YYYYMMDD/<id>.json objects
+	ArchivePrefix string
+	OutputPrefix  string
+	// Region - Region of the legacy objects, whose keys don't carry it
+	Region string
+	// Lock - Claims each scheduled day for one replica; nil exports in every replica
+	Lock Lock
+}
+
+// Column - Name and type of a Parquet column
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// File - One Parquet file of the export; one per day
+type File struct {
+	Key        string `json:"key"`
+	Date       string `json:"date"`
+	Records    int    `json:"records"`
+	Bytes      int    `json:"bytes"`
+	Sources    int    `json:"sources"`
+	Duplicates int    `json:"duplicates"`
+}
+
+// Manifest - Summary of an export written next to its Parquet files
+type Manifest struct {
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Schema      []Column  `json:"schema"`
+	Files       []File    `json:"files"`
+	Records     int       `json:"records"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+const dateLayout = "2006-01-02"
+
+// Run - Exports every UTC day from from to to, both included, and writes the manifest to
+// <OutputPrefix>/manifests/<from>_<to>.json
+func Run(ctx context.Context, config Config, from time.Time, to time.Time) (*Manifest, error) {
+	if config.ArchivePrefix == "" {
+		config.ArchivePrefix = "sales"
+	}
+	if config.OutputPrefix == "" {
+		config.OutputPrefix = "exports/parquet"
+	}
+	if config.Region == "" {
+		config.Region = os.Getenv("AWS_REGION")
+	}
+
+	from = truncateDay(from)
+	to = truncateDay(to)
+	if to.Before(from) {
+		return nil, fmt.Errorf("export range ends before it starts: %s to %s", from.Format(dateLayout), to.Format(dateLayout))
+	}
+
+	manifest := &Manifest{
+		From:        from.Format(dateLayout),
+		To:          to.Format(dateLayout),
+		Source:      config.Source.String(),
+		Destination: config.Destination.String(),
+		Schema:      Schema,
+		Files:       []File{},
+	}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		file, err := exportDay(ctx, config, day)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			manifest.Files = append(manifest.Files, *file)
+			manifest.Records += file.Records
+		}
+	}
+
+	manifest.GeneratedAt = time.Now().UTC()
+
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s/manifests/%s_%s.json", config.OutputPrefix, manifest.From, manifest.To)
+	if err := config.Destination.Write(ctx, key, body); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// exportDay - Reads the archived sales of the day into one Parquet file;
+// nil when the day has no sales. Redelivered sales appear more than once in the archive; the
+// newest copy is kept, as the restore does
+func exportDay(ctx context.Context, config Config, day time.Time) (*File, error) {
+	logger := log.FromContext(ctx)
+
+	sources := 0
+	duplicates := 0
+	index := make(map[string]int)
+	rows := []Row{}
+
+	add := func(sale sales_model.Model, region string) {
+		row := Row{
+			ID:        sale.ID,
+			Product:   sale.Product,
+			Amount:    sale.Amount,
+			Timestamp: sale.Timestamp * 1000,
+			Processed: true,
+			Region:    region,
+		}
+
+		if i, found := index[sale.ID]; found {
+			duplicates++
+			if row.Timestamp > rows[i].Timestamp {
+				rows[i] = row
+			}
+			return
+		}
+		index[sale.ID] = len(rows)
+		rows = append(rows, row)
+	}
+
+	archived, err := archive.Sources(ctx, config.Source, config.ArchivePrefix, config.Region, day)
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range archived {
+		sales, err := archive.Read(ctx, config.Source, source)
+		if err != nil {
+			return nil, err
+		}
+		for _, sale := range sales {
+			add(sale, source.Region)
+		}
+		sources++
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Timestamp != rows[j].Timestamp {
+			return rows[i].Timestamp < rows[j].Timestamp
+		}
+		return rows[i].ID < rows[j].ID
+	})
+
+	body, err := writeParquet(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s/year=%04d/month=%02d/day=%02d/sales.parquet", config.OutputPrefix, day.Year(), int(day.Month()), day.Day())
+	if err := config.Destination.Write(ctx, key, body); err != nil {
+		return nil, err
+	}
+
+	logger.Info().
+		Str("Action", "export").
+		Str("Date", day.Format(dateLayout)).
+		Str("Path", key).
+		Int("Records", len(rows)).
+		Int("Sources", sources).
+		Int("Duplicates", duplicates).
+		Msg("Sales exported to Parquet")
+
+	return &File{
+		Key:        key,
+		Date:       day.Format(dateLayout),
+		Records:    len(rows),
+		Bytes:      len(body),
+		Sources:    sources,
+		Duplicates: duplicates,
+	}, nil
+}
+
+// writeParquet - Snappy compressed Parquet file of the rows
+func writeParquet(rows []Row) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	pw, err := writer.NewParquetWriterFromWriter(&buffer, new(Row), 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	utc := t.UTC()
+	return time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+}
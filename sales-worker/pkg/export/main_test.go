@@ -0,0 +1,266 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"sales-worker/models/sales_model"
+	"sales-worker/pkg/archive"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+var day = time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+
+// writePart - Gzip NDJSON archive part of the sales at key
+func writePart(t *testing.T, storage archive.Storage, key string, sales ...sales_model.Model) {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	for _, sale := range sales {
+		line, _ := json.Marshal(sale)
+		gz.Write(append(line, '\n'))
+	}
+	gz.Close()
+
+	if err := storage.Write(context.Background(), key, body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeLegacy - Per-sale JSON object of the legacy archive layout
+func writeLegacy(t *testing.T, storage archive.Storage, sale sales_model.Model) {
+	body, _ := json.Marshal(sale)
+	if err := storage.Write(context.Background(), "sales/"+day.Format("20060102")+"/"+sale.ID+".json", body); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readRows - Rows of the Parquet file at key
+func readRows(t *testing.T, storage archive.Storage, key string) map[string]Row {
+	body, err := storage.Read(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := buffer.NewBufferFile(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetReader(file, new(Row), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+
+	rows := make([]Row, pr.GetNumRows())
+	if err := pr.Read(&rows); err != nil {
+		t.Fatal(err)
+	}
+
+	byID := make(map[string]Row, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row
+	}
+	return byID
+}
+
+func TestRun(t *testing.T) {
+
+	storage := &archive.LocalStorage{Root: t.TempDir()}
+	created := day.Add(10 * time.Hour).Unix()
+
+	writePart(t, storage, "sales/year=2026/month=10/day=18/region=us-east-1/part-1.ndjson.gz",
+		sales_model.Model{ID: "a", Product: "book", Amount: 10, Timestamp: created + 60},
+		sales_model.Model{ID: "b", Product: "pen", Amount: 2, Timestamp: created},
+	)
+	// Redelivered copy of a, older than the one in part-1 but read after it
+	writePart(t, storage, "sales/year=2026/month=10/day=18/region=us-west-2/part-2.ndjson.gz",
+		sales_model.Model{ID: "a", Product: "book", Amount: 9, Timestamp: created},
+	)
+	writeLegacy(t, storage, sales_model.Model{ID: "b", Product: "pen", Amount: 3, Timestamp: created + 120})
+	writeLegacy(t, storage, sales_model.Model{ID: "c", Product: "cup", Amount: 5, Timestamp: created})
+
+	manifest, err := Run(context.Background(), Config{Source: storage, Destination: storage, Region: "us-east-1"}, day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest.Files) != 1 {
+		t.Fatalf("got %d files want 1", len(manifest.Files))
+	}
+	file := manifest.Files[0]
+	if file.Records != 3 || file.Sources != 4 || file.Duplicates != 2 {
+		t.Errorf("got %d records, %d sources, %d duplicates want 3, 4, 2", file.Records, file.Sources, file.Duplicates)
+	}
+
+	rows := readRows(t, storage, file.Key)
+	tests := map[string]struct {
+		id     string
+		amount float64
+		region string
+	}{
+		"Newest Copy Read First": {"a", 10, "us-east-1"},
+		"Newest Copy Read Last":  {"b", 3, "us-east-1"},
+		"Legacy Object":          {"c", 5, "us-east-1"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			row, found := rows[test.id]
+			if !found {
+				t.Fatalf("sale %s not exported", test.id)
+			}
+			if row.Amount != test.amount || row.Region != test.region || !row.Processed {
+				t.Errorf("got %+v", row)
+			}
+		})
+	}
+
+	t.Run("Empty Day", func(t *testing.T) {
+		manifest, err := Run(context.Background(), Config{Source: storage, Destination: storage}, day.AddDate(0, 0, 1), day.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(manifest.Files) != 0 {
+			t.Errorf("got %d files want 0", len(manifest.Files))
+		}
+	})
+
+	t.Run("Range Ends Before It Starts", func(t *testing.T) {
+		if _, err := Run(context.Background(), Config{Source: storage, Destination: storage}, day, day.AddDate(0, 0, -1)); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+}
+
+// fakeLock - In-memory claims with the semantics of the idempotency table
+type fakeLock struct {
+	claims    map[string]string
+	completed map[string]bool
+}
+
+func newFakeLock() *fakeLock {
+	return &fakeLock{claims: map[string]string{}, completed: map[string]bool{}}
+}
+
+func (l *fakeLock) ClaimIdempotencyWithContext(ctx context.Context, id string, owner string, lease time.Duration, ttl time.Duration) error {
+	if l.completed[id] {
+		return sales_model.ErrAlreadyProcessed
+	}
+	if current, found := l.claims[id]; found && current != owner {
+		return sales_model.ErrClaimedByOther
+	}
+	l.claims[id] = owner
+	return nil
+}
+
+func (l *fakeLock) CompleteIdempotencyWithContext(ctx context.Context, id string, owner string, ttl time.Duration) error {
+	l.completed[id] = true
+	return nil
+}
+
+func (l *fakeLock) ReleaseIdempotencyWithContext(ctx context.Context, id string, owner string) error {
+	delete(l.claims, id)
+	return nil
+}
+
+// failingStorage - Storage whose writes fail while failing is set
+type failingStorage struct {
+	archive.LocalStorage
+	failing bool
+}
+
+func (s *failingStorage) Write(ctx context.Context, key string, body []byte) error {
+	if s.failing {
+		return errors.New("service unavailable")
+	}
+	return s.LocalStorage.Write(ctx, key, body)
+}
+
+func TestExportPending(t *testing.T) {
+
+	source := &archive.LocalStorage{Root: t.TempDir()}
+	writeLegacy(t, source, sales_model.Model{ID: "a", Timestamp: day.Unix()})
+	now := day.Add(25 * time.Hour)
+
+	t.Run("Exported Once Across Replicas", func(t *testing.T) {
+		lock := newFakeLock()
+		destination := &archive.LocalStorage{Root: t.TempDir()}
+		config := Config{Source: source, Destination: destination, Lock: lock}
+
+		if retry := exportPending(context.Background(), config, "replica-a", []time.Time{day}, now); len(retry) != 0 {
+			t.Errorf("got %v to retry", retry)
+		}
+		if retry := exportPending(context.Background(), config, "replica-b", []time.Time{day}, now); len(retry) != 0 {
+			t.Errorf("exported day retried by another replica: %v", retry)
+		}
+	})
+
+	t.Run("Held By Another Replica", func(t *testing.T) {
+		lock := newFakeLock()
+		lock.claims["export#2026-10-18"] = "replica-a"
+		config := Config{Source: source, Destination: &archive.LocalStorage{Root: t.TempDir()}, Lock: lock}
+
+		if retry := exportPending(context.Background(), config, "replica-b", []time.Time{day}, now); len(retry) != 1 {
+			t.Errorf("got %v want the day retried", retry)
+		}
+	})
+
+	t.Run("Failed Day Retried", func(t *testing.T) {
+		lock := newFakeLock()
+		destination := &failingStorage{LocalStorage: archive.LocalStorage{Root: t.TempDir()}, failing: true}
+		config := Config{Source: source, Destination: destination, Lock: lock}
+
+		retry := exportPending(context.Background(), config, "replica-a", []time.Time{day}, now)
+		if len(retry) != 1 {
+			t.Fatalf("got %v want the day retried", retry)
+		}
+		if _, held := lock.claims["export#2026-10-18"]; held {
+			t.Error("failed day still claimed")
+		}
+
+		destination.failing = false
+		if retry := exportPending(context.Background(), config, "replica-b", retry, now); len(retry) != 0 {
+			t.Errorf("got %v to retry", retry)
+		}
+		if !lock.completed["export#2026-10-18"] {
+			t.Error("exported day not completed")
+		}
+	})
+
+	t.Run("Past Retry Window", func(t *testing.T) {
+		destination := &failingStorage{LocalStorage: archive.LocalStorage{Root: t.TempDir()}, failing: true}
+		config := Config{Source: source, Destination: destination}
+
+		if retry := exportPending(context.Background(), config, "replica-a", []time.Time{day}, day.Add(retryWindow+time.Hour)); len(retry) != 0 {
+			t.Errorf("got %v want the day dropped", retry)
+		}
+	})
+
+}
+
+func TestNextRun(t *testing.T) {
+
+	tests := map[string]struct {
+		now  time.Time
+		want time.Time
+	}{
+		"Before Offset": {day.Add(30 * time.Minute), day.Add(time.Hour)},
+		"At Offset":     {day.Add(time.Hour), day.AddDate(0, 0, 1).Add(time.Hour)},
+		"After Offset":  {day.Add(5 * time.Hour), day.AddDate(0, 0, 1).Add(time.Hour)},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := nextRun(test.now, time.Hour); !got.Equal(test.want) {
+				t.Errorf("got %s want %s", got, test.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,77 @@
+package failure
+
+import (
+	"encoding/json"
+	"errors"
+
+	"sales-worker/pkg/events"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Kind - How the worker reacts to a processing error
+type Kind int
+
+const (
+	// Retryable - Transient dependency failure; the message is redelivered with backoff
+	Retryable Kind = iota
+	// Permanent - The message can never succeed; it goes to the dead-letter destination
+	Permanent
+	// NotReplicated - The sale has not reached this region yet; redelivered after a short delay
+	NotReplicated
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Permanent:
+		return "permanent"
+	case NotReplicated:
+		return "not-replicated"
+	default:
+		return "retryable"
+	}
+}
+
+// Error - Processing error tagged with its Kind
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.String() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NewRetryable(err error) error {
+	return &Error{Kind: Retryable, Err: err}
+}
+
+func NewPermanent(err error) error {
+	return &Error{Kind: Permanent, Err: err}
+}
+
+func NewNotReplicated(err error) error {
+	return &Error{Kind: NotReplicated, Err: err}
+}
+
+// Classify - Kind of err; untagged errors are permanent when the message itself is invalid
+func Classify(err error) Kind {
+	var tagged *Error
+	if errors.As(err, &tagged) {
+		return tagged.Kind
+	}
+
+	var syntax *json.SyntaxError
+	var unmarshal *json.UnmarshalTypeError
+	var validation *jsonschema.ValidationError
+	if errors.Is(err, events.ErrUnsupportedEvent) || errors.As(err, &syntax) || errors.As(err, &unmarshal) || errors.As(err, &validation) {
+		return Permanent
+	}
+
+	// Dependency errors, open breakers and expired deadlines; the max receive count bounds them
+	return Retryable
+}
@@ -0,0 +1,50 @@
+package failure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"sales-worker/pkg/events"
+)
+
+func TestClassify(t *testing.T) {
+
+	var syntax_err error
+	if err := json.Unmarshal([]byte("{"), &struct{}{}); err != nil {
+		syntax_err = err
+	}
+
+	var unmarshal_err error
+	if err := json.Unmarshal([]byte(`{"amount":"ten"}`), &struct {
+		Amount float64 `json:"amount"`
+	}{}); err != nil {
+		unmarshal_err = err
+	}
+
+	tests := map[string]struct {
+		err  error
+		want Kind
+	}{
+		"Tagged Retryable":      {NewRetryable(errors.New("throttled")), Retryable},
+		"Tagged Permanent":      {NewPermanent(errors.New("bad message")), Permanent},
+		"Tagged Not Replicated": {NewNotReplicated(errors.New("sale not found")), NotReplicated},
+		"Wrapped Tag":           {fmt.Errorf("processing: %w", NewNotReplicated(errors.New("sale not found"))), NotReplicated},
+		"JSON Syntax":           {syntax_err, Permanent},
+		"JSON Type":             {unmarshal_err, Permanent},
+		"Unsupported Event":     {fmt.Errorf("%w: no handler", events.ErrUnsupportedEvent), Permanent},
+		"Deadline":              {context.DeadlineExceeded, Retryable},
+		"Dependency Error":      {errors.New("connection reset"), Retryable},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := Classify(test.err); got != test.want {
+				t.Errorf("got %s want %s", got, test.want)
+			}
+		})
+	}
+
+}
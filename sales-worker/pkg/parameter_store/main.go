@@ -1,19 +1,41 @@
 package parameter_store
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
 
 	"sales-worker/pkg/log"
 	"sales-worker/pkg/memory_cache"
+	"sales-worker/pkg/resilience"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
 )
 
+// GetSiteState - Returns the site state parameter and attaches it to the log entries
+func GetSiteState(cache_time int64) (string, error) {
+	return GetSiteStateWithContext(context.Background(), cache_time)
+}
+
+// GetSiteStateWithContext - GetSiteState bounded by ctx
+func GetSiteStateWithContext(ctx context.Context, cache_time int64) (string, error) {
+	site_state, err := GetParamValueWithContext(ctx, os.Getenv("SSM_PARAMETER_STORE_STATE"), cache_time)
+	if err != nil {
+		return site_state, err
+	}
+	log.SetState(site_state)
+	return site_state, nil
+}
+
 func GetParamValue(parameter string, cache_time int64) (string, error) {
+	return GetParamValueWithContext(context.Background(), parameter, cache_time)
+}
+
+// GetParamValueWithContext - Returns the parameter value, from the local cache when cache_time > 0
+func GetParamValueWithContext(ctx context.Context, parameter string, cache_time int64) (string, error) {
 
 	m := memory_cache.GetInstance()
 	log := log.Instance()
@@ -25,13 +47,11 @@ func GetParamValue(parameter string, cache_time int64) (string, error) {
 		if found {
 			log.Info().
 				Str("Parameter Store", parameter).
-				Str("AWS_REGION", os.Getenv("AWS_REGION")).
 				Msg("Returning parameter store value from cache")
 			return fmt.Sprint(value), nil
 		} else {
 			log.Info().
 				Str("Parameter Store", parameter).
-				Str("AWS_REGION", os.Getenv("AWS_REGION")).
 				Msg("Parameter value don't found in cache")
 		}
 
@@ -47,9 +67,13 @@ func GetParamValue(parameter string, cache_time int64) (string, error) {
 
 	svc := ssm.New(sess)
 
-	result, err := svc.GetParameter(&ssm.GetParameterInput{
-		Name:           aws.String(parameter),
-		WithDecryption: aws.Bool(false),
+	var result *ssm.GetParameterOutput
+	err = resilience.Call(ctx, resilience.SSM, func(ctx context.Context) error {
+		result, err = svc.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(parameter),
+			WithDecryption: aws.Bool(false),
+		})
+		return err
 	})
 
 	if err != nil {
@@ -59,7 +83,6 @@ func GetParamValue(parameter string, cache_time int64) (string, error) {
 	if cache_time > 0 {
 		log.Info().
 			Str("Parameter Store", parameter).
-			Str("AWS_REGION", os.Getenv("AWS_REGION")).
 			Int64("Cache_Time_Seconds", cache_time).
 			Msg("Saving parameter store value on local cache")
 
@@ -69,3 +92,37 @@ func GetParamValue(parameter string, cache_time int64) (string, error) {
 	return fmt.Sprint(*result.Parameter.Value), nil
 
 }
+
+// GetSecureParamValue - Returns a decrypted SecureString parameter; secrets are never cached
+func GetSecureParamValue(parameter string) (string, error) {
+	return GetSecureParamValueWithContext(context.Background(), parameter)
+}
+
+// GetSecureParamValueWithContext - GetSecureParamValue bounded by ctx
+func GetSecureParamValueWithContext(ctx context.Context, parameter string) (string, error) {
+
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(os.Getenv("AWS_REGION")),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	svc := ssm.New(sess)
+
+	var result *ssm.GetParameterOutput
+	err = resilience.Call(ctx, resilience.SSM, func(ctx context.Context) error {
+		result, err = svc.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(parameter),
+			WithDecryption: aws.Bool(true),
+		})
+		return err
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprint(*result.Parameter.Value), nil
+}
@@ -0,0 +1,26 @@
+package resilience
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "Circuit breaker state by dependency: 0 closed, 1 half-open, 2 open",
+	}, []string{"dependency"})
+
+	transitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "circuit_breaker_transitions_total",
+		Help: "Circuit breaker state transitions by dependency and target state",
+	}, []string{"dependency", "state"})
+
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dependency_retries_total",
+		Help: "Retried calls by dependency",
+	}, []string{"dependency"})
+)
+
+func init() {
+	prometheus.MustRegister(breakerState, transitions, retries)
+}
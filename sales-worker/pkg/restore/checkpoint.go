@@ -0,0 +1,77 @@
+package restore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint - Progress of a restore: every source up to LastKey of Day is written
+type Checkpoint struct {
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Day         string    `json:"day"`
+	LastKey     string    `json:"last_key"`
+	Sources     int       `json:"sources"`
+	Written     int       `json:"written"`
+	Skipped     int       `json:"skipped"`
+	Idempotency int       `json:"idempotency"`
+	Completed   bool      `json:"completed"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// loadCheckpoint - Checkpoint of the range saved at path; a fresh one when there is none
+func loadCheckpoint(path string, from string, to string) (*Checkpoint, error) {
+	fresh := &Checkpoint{From: from, To: to}
+	if path == "" {
+		return fresh, nil
+	}
+
+	body, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(body, &checkpoint); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if checkpoint.From != from || checkpoint.To != to {
+		return nil, fmt.Errorf("checkpoint %s belongs to the restore from %s to %s", path, checkpoint.From, checkpoint.To)
+	}
+	return &checkpoint, nil
+}
+
+// save - Replaces the checkpoint file atomically; no-op without a path
+func (c *Checkpoint) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	c.UpdatedAt = time.Now().UTC()
+	body, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temporary, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := temporary.Write(body); err != nil {
+		temporary.Close()
+		os.Remove(temporary.Name())
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		os.Remove(temporary.Name())
+		return err
+	}
+	return os.Rename(temporary.Name(), path)
+}
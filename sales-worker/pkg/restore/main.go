@@ -0,0 +1,258 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sales-worker/models/sales_model"
+	"sales-worker/pkg/archive"
+	"sales-worker/pkg/log"
+)
+
+// Config - Archive read by the restore and how fast it writes back to DynamoDB
+type Config struct {
+	Source        archive.Storage
+	ArchivePrefix string
+	// Region - Region of the legacy objects, whose keys don't carry it
+	Region string
+	// Checkpoint - Local file the progress is saved to after every archived object; empty
+	// disables resuming
+	Checkpoint string
+	// Rate - Items written per second across both tables, one conditional write call per item;
+	// 0 doesn't throttle
+	Rate float64
+	// IdempotencyTTL - Age of the COMPLETED idempotency records rebuilt for the restored sales;
+	// 0 skips the idempotency table
+	IdempotencyTTL time.Duration
+}
+
+// Store - Sales and idempotency tables the restore writes to; the sales DAO in production
+type Store interface {
+	BatchGetWithContext(ctx context.Context, ids []string) (map[string]sales_model.Model, error)
+	RestoreWithContext(ctx context.Context, model sales_model.Model) (bool, error)
+	RestoreIdempotencyWithContext(ctx context.Context, record sales_model.Idempotency) (bool, error)
+}
+
+const (
+	dateLayout = "2006-01-02"
+
+	// restoreOwner - Owner of the rebuilt idempotency records
+	restoreOwner = "restore"
+)
+
+// Run - Writes the sales archived from from to to, both included, back to the sales table and
+// rebuilds their missing idempotency records. Table items with a newer timestamp are kept, also
+// when a consumer writes them during the restore. Resumes from the checkpoint of the same
+// range when there is one
+func Run(ctx context.Context, store Store, config Config, from time.Time, to time.Time) (*Checkpoint, error) {
+	if config.ArchivePrefix == "" {
+		config.ArchivePrefix = "sales"
+	}
+
+	from = truncateDay(from)
+	to = truncateDay(to)
+	if to.Before(from) {
+		return nil, fmt.Errorf("restore range ends before it starts: %s to %s", from.Format(dateLayout), to.Format(dateLayout))
+	}
+
+	checkpoint, err := loadCheckpoint(config.Checkpoint, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.Completed {
+		return checkpoint, nil
+	}
+
+	logger := log.FromContext(ctx)
+	if checkpoint.Day != "" {
+		logger.Info().
+			Str("Action", "restore").
+			Str("Day", checkpoint.Day).
+			Str("LastKey", checkpoint.LastKey).
+			Msg("Resuming restore from checkpoint")
+	}
+
+	throttle := &limiter{rate: config.Rate}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateLayout)
+		if checkpoint.Day != "" && date < checkpoint.Day {
+			continue
+		}
+
+		sources, err := archive.Sources(ctx, config.Source, config.ArchivePrefix, config.Region, day)
+		if err != nil {
+			return checkpoint, err
+		}
+
+		for _, source := range sources {
+			if date == checkpoint.Day && source.Key <= checkpoint.LastKey {
+				continue
+			}
+
+			sales, err := archive.Read(ctx, config.Source, source)
+			if err != nil {
+				return checkpoint, err
+			}
+
+			if err := restoreSales(ctx, store, config, throttle, checkpoint, sales); err != nil {
+				return checkpoint, err
+			}
+
+			checkpoint.Day = date
+			checkpoint.LastKey = source.Key
+			checkpoint.Sources++
+			if err := checkpoint.save(config.Checkpoint); err != nil {
+				return checkpoint, err
+			}
+		}
+
+		logger.Info().
+			Str("Action", "restore").
+			Str("Date", date).
+			Int("Written", checkpoint.Written).
+			Int("Skipped", checkpoint.Skipped).
+			Int("Idempotency", checkpoint.Idempotency).
+			Msg("Day restored")
+	}
+
+	checkpoint.Completed = true
+	return checkpoint, checkpoint.save(config.Checkpoint)
+}
+
+// restoreSales - Writes the archived sales missing from the table or older there, then the
+// idempotency records of the sales written still inside the idempotency TTL. The BatchGet
+// only saves writes; the conditional puts decide
+func restoreSales(ctx context.Context, store Store, config Config, throttle *limiter, checkpoint *Checkpoint, sales []sales_model.Model) error {
+	now := time.Now()
+
+	for start := 0; start < len(sales); start += sales_model.MaxBatchGet {
+		chunk := unique(sales[start:batchEnd(start, sales_model.MaxBatchGet, len(sales))])
+
+		ids := make([]string, 0, len(chunk))
+		for _, sale := range chunk {
+			ids = append(ids, sale.ID)
+		}
+
+		existing, err := store.BatchGetWithContext(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, sale := range chunk {
+			// Archived sales were processed by the worker
+			sale.Processed = true
+
+			current, found := existing[sale.ID]
+			switch {
+			case found && current.Timestamp > sale.Timestamp:
+				checkpoint.Skipped++
+				continue
+			case found && current.Timestamp == sale.Timestamp && current.Processed:
+				// Same copy; only its idempotency record may be missing, e.g. when resuming
+				checkpoint.Skipped++
+			default:
+				if err := throttle.wait(ctx, 1); err != nil {
+					return err
+				}
+				written, err := store.RestoreWithContext(ctx, sale)
+				if err != nil {
+					return err
+				}
+				if !written {
+					// Written by a consumer since the read
+					checkpoint.Skipped++
+					continue
+				}
+				checkpoint.Written++
+			}
+
+			expires_at := time.Unix(sale.Timestamp, 0).Add(config.IdempotencyTTL)
+			if config.IdempotencyTTL <= 0 || !expires_at.After(now) {
+				continue
+			}
+
+			if err := throttle.wait(ctx, 1); err != nil {
+				return err
+			}
+			created, err := store.RestoreIdempotencyWithContext(ctx, sales_model.Idempotency{
+				ID:        sale.ID,
+				Status:    sales_model.IdempotencyCompleted,
+				Owner:     restoreOwner,
+				ExpiresAt: expires_at.Unix(),
+				UpdatedAt: now.Unix(),
+			})
+			if err != nil {
+				return err
+			}
+			if created {
+				checkpoint.Idempotency++
+			}
+		}
+	}
+
+	return nil
+}
+
+// unique - Keeps the newest copy of every sale; BatchGetItem rejects duplicated keys and
+// redelivered sales appear more than once in the archive
+func unique(sales []sales_model.Model) []sales_model.Model {
+	index := make(map[string]int, len(sales))
+	result := make([]sales_model.Model, 0, len(sales))
+
+	for _, sale := range sales {
+		if i, found := index[sale.ID]; found {
+			if sale.Timestamp > result[i].Timestamp {
+				result[i] = sale
+			}
+			continue
+		}
+		index[sale.ID] = len(result)
+		result = append(result, sale)
+	}
+	return result
+}
+
+// batchEnd - End of the batch starting at start, capped at total
+func batchEnd(start int, size int, total int) int {
+	if start+size > total {
+		return total
+	}
+	return start + size
+}
+
+// limiter - Spaces the writes to rate items per second
+type limiter struct {
+	rate float64
+	next time.Time
+}
+
+func (l *limiter) wait(ctx context.Context, items int) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(items) / l.rate * float64(time.Second)))
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+func truncateDay(t time.Time) time.Time {
+	utc := t.UTC()
+	return time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,285 @@
+package restore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"sales-worker/models/sales_model"
+	"sales-worker/pkg/archive"
+)
+
+var day = time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+
+// forever - Idempotency TTL that keeps every test sale inside it
+const forever = 100 * 365 * 24 * time.Hour
+
+// fakeStore - Tables in memory with the conditions of the DAO; the fail_after-th sale
+// restore fails, interrupting the run
+type fakeStore struct {
+	sales       map[string]sales_model.Model
+	idempotency map[string]sales_model.Idempotency
+	restores    int
+	fail_after  int
+	// concurrent - Written by a consumer between the BatchGet and the put
+	concurrent map[string]sales_model.Model
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		sales:       map[string]sales_model.Model{},
+		idempotency: map[string]sales_model.Idempotency{},
+		concurrent:  map[string]sales_model.Model{},
+	}
+}
+
+func (s *fakeStore) BatchGetWithContext(ctx context.Context, ids []string) (map[string]sales_model.Model, error) {
+	found := map[string]sales_model.Model{}
+	for _, id := range ids {
+		if sale, ok := s.sales[id]; ok {
+			found[id] = sale
+		}
+	}
+	for id, sale := range s.concurrent {
+		s.sales[id] = sale
+	}
+	return found, nil
+}
+
+func (s *fakeStore) RestoreWithContext(ctx context.Context, model sales_model.Model) (bool, error) {
+	s.restores++
+	if s.fail_after > 0 && s.restores == s.fail_after {
+		return false, errors.New("throughput exceeded")
+	}
+
+	current, found := s.sales[model.ID]
+	if found && (current.Timestamp > model.Timestamp || (current.Timestamp == model.Timestamp && current.Processed)) {
+		return false, nil
+	}
+	s.sales[model.ID] = model
+	return true, nil
+}
+
+func (s *fakeStore) RestoreIdempotencyWithContext(ctx context.Context, record sales_model.Idempotency) (bool, error) {
+	if _, found := s.idempotency[record.ID]; found {
+		return false, nil
+	}
+	s.idempotency[record.ID] = record
+	return true, nil
+}
+
+func writePart(t *testing.T, storage archive.Storage, key string, sales ...sales_model.Model) {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	for _, sale := range sales {
+		line, _ := json.Marshal(sale)
+		gz.Write(append(line, '\n'))
+	}
+	gz.Close()
+
+	if err := storage.Write(context.Background(), key, body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeLegacy(t *testing.T, storage archive.Storage, sale sales_model.Model) {
+	body, _ := json.Marshal(sale)
+	if err := storage.Write(context.Background(), "sales/20261018/"+sale.ID+".json", body); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mixedDay - Archive of a day with legacy objects and NDJSON parts; returns the sale ids
+func mixedDay(t *testing.T) (archive.Storage, []string) {
+	storage := &archive.LocalStorage{Root: t.TempDir()}
+	created := day.Add(time.Hour).Unix()
+
+	writeLegacy(t, storage, sales_model.Model{ID: "legacy-1", Timestamp: created})
+	writeLegacy(t, storage, sales_model.Model{ID: "legacy-2", Timestamp: created})
+	writePart(t, storage, "sales/year=2026/month=10/day=18/region=us-east-1/part-1.ndjson.gz",
+		sales_model.Model{ID: "part-1a", Timestamp: created},
+		sales_model.Model{ID: "part-1b", Timestamp: created},
+	)
+	writePart(t, storage, "sales/year=2026/month=10/day=18/region=us-east-1/part-2.ndjson.gz",
+		sales_model.Model{ID: "part-2a", Timestamp: created},
+	)
+
+	return storage, []string{"legacy-1", "legacy-2", "part-1a", "part-1b", "part-2a"}
+}
+
+func TestSources(t *testing.T) {
+	storage, _ := mixedDay(t)
+
+	sources, err := archive.Sources(context.Background(), storage, "sales", "us-east-1", day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]string, 0, len(sources))
+	for _, source := range sources {
+		keys = append(keys, source.Key)
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("sources not in key order: %v", keys)
+	}
+	if len(keys) != 4 {
+		t.Errorf("got %d sources want 4", len(keys))
+	}
+}
+
+func TestRun(t *testing.T) {
+
+	t.Run("Resume Over A Mixed Day", func(t *testing.T) {
+		storage, ids := mixedDay(t)
+		checkpoint := filepath.Join(t.TempDir(), "restore.json")
+		config := Config{Source: storage, Checkpoint: checkpoint, IdempotencyTTL: forever}
+
+		// Fails on the last part, after the legacy objects and part-1 are checkpointed
+		store := newFakeStore()
+		store.fail_after = 5
+		progress, err := Run(context.Background(), store, config, day, day)
+		if err == nil {
+			t.Fatal("expected the interrupted run to fail")
+		}
+		if progress.Sources != 3 || !strings.HasSuffix(progress.LastKey, "part-1.ndjson.gz") {
+			t.Fatalf("got checkpoint after %d sources at %s", progress.Sources, progress.LastKey)
+		}
+
+		store.fail_after = 0
+		progress, err = Run(context.Background(), store, config, day, day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !progress.Completed || progress.Sources != 4 {
+			t.Errorf("got completed %v after %d sources", progress.Completed, progress.Sources)
+		}
+
+		for _, id := range ids {
+			if _, found := store.sales[id]; !found {
+				t.Errorf("sale %s not restored", id)
+			}
+			if _, found := store.idempotency[id]; !found {
+				t.Errorf("idempotency of %s not rebuilt", id)
+			}
+		}
+
+		// A completed checkpoint doesn't read the archive again
+		restores := store.restores
+		if _, err := Run(context.Background(), store, config, day, day); err != nil {
+			t.Fatal(err)
+		}
+		if store.restores != restores {
+			t.Errorf("completed restore ran again")
+		}
+	})
+
+	t.Run("Table Items Kept", func(t *testing.T) {
+		storage := &archive.LocalStorage{Root: t.TempDir()}
+		created := day.Add(time.Hour).Unix()
+		writePart(t, storage, "sales/year=2026/month=10/day=18/region=us-east-1/part-1.ndjson.gz",
+			sales_model.Model{ID: "newer", Amount: 1, Timestamp: created},
+			sales_model.Model{ID: "live", Amount: 1, Timestamp: created},
+			sales_model.Model{ID: "raced", Amount: 1, Timestamp: created},
+			sales_model.Model{ID: "missing", Amount: 1, Timestamp: created},
+		)
+
+		store := newFakeStore()
+		store.sales["newer"] = sales_model.Model{ID: "newer", Amount: 2, Timestamp: created + 60}
+		store.idempotency["live"] = sales_model.Idempotency{ID: "live", Status: sales_model.IdempotencyInProgress, Owner: "worker-a"}
+		store.concurrent["raced"] = sales_model.Model{ID: "raced", Amount: 3, Timestamp: created + 60, Processed: true}
+
+		progress, err := Run(context.Background(), store, Config{Source: storage, IdempotencyTTL: forever}, day, day)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if store.sales["newer"].Amount != 2 || store.sales["raced"].Amount != 3 {
+			t.Errorf("newer table items overwritten: %+v %+v", store.sales["newer"], store.sales["raced"])
+		}
+		if store.idempotency["live"].Status != sales_model.IdempotencyInProgress {
+			t.Errorf("live claim overwritten: %+v", store.idempotency["live"])
+		}
+		for _, id := range []string{"newer", "raced"} {
+			if _, found := store.idempotency[id]; found {
+				t.Errorf("idempotency record written for skipped sale %s", id)
+			}
+		}
+		if _, found := store.idempotency["missing"]; !found {
+			t.Error("idempotency of the restored sale not rebuilt")
+		}
+		if progress.Written != 2 || progress.Skipped != 2 || progress.Idempotency != 1 {
+			t.Errorf("got %d written, %d skipped, %d idempotency want 2, 2, 1", progress.Written, progress.Skipped, progress.Idempotency)
+		}
+	})
+
+	t.Run("Expired Idempotency Not Rebuilt", func(t *testing.T) {
+		storage := &archive.LocalStorage{Root: t.TempDir()}
+		writeLegacy(t, storage, sales_model.Model{ID: "old", Timestamp: day.Unix()})
+
+		store := newFakeStore()
+		if _, err := Run(context.Background(), store, Config{Source: storage, IdempotencyTTL: time.Hour}, day, day); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := store.idempotency["old"]; found {
+			t.Error("idempotency record rebuilt past its TTL")
+		}
+	})
+
+}
+
+func TestCheckpoint(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "restore.json")
+
+	fresh, err := loadCheckpoint(path, "2026-10-18", "2026-10-19")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Day != "" || fresh.From != "2026-10-18" {
+		t.Errorf("got %+v want a fresh checkpoint", fresh)
+	}
+
+	fresh.Day = "2026-10-18"
+	fresh.LastKey = "sales/20261018/a.json"
+	fresh.Written = 3
+	if err := fresh.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadCheckpoint(path, "2026-10-18", "2026-10-19")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.LastKey != fresh.LastKey || loaded.Written != 3 {
+		t.Errorf("got %+v", loaded)
+	}
+
+	if _, err := loadCheckpoint(path, "2026-10-01", "2026-10-19"); err == nil {
+		t.Error("expected error for the checkpoint of another range")
+	}
+
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+
+}
+
+func TestUnique(t *testing.T) {
+	sales := unique([]sales_model.Model{
+		{ID: "a", Amount: 1, Timestamp: 10},
+		{ID: "b", Amount: 1, Timestamp: 10},
+		{ID: "a", Amount: 2, Timestamp: 20},
+		{ID: "a", Amount: 3, Timestamp: 15},
+	})
+
+	if len(sales) != 2 || sales[0].Amount != 2 {
+		t.Errorf("got %+v want the newest copy of a", sales)
+	}
+}
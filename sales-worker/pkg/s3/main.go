@@ -2,16 +2,24 @@ package s3
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"log"
 	"net/http"
 	"os"
 
+	"sales-worker/pkg/resilience"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 func Upload(bucket string, source string, key string) error {
+	return UploadWithContext(context.Background(), bucket, source, key)
+}
+
+func UploadWithContext(ctx context.Context, bucket string, source string, key string) error {
 
 	session, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
 	if err != nil {
@@ -31,7 +39,8 @@ func Upload(bucket string, source string, key string) error {
 	fileBuffer := make([]byte, fileSize)
 	upFile.Read(fileBuffer)
 
-	_, err = s3.New(session).PutObject(&s3.PutObjectInput{
+	svc := s3.New(session)
+	input := &s3.PutObjectInput{
 		Bucket:               aws.String(bucket),
 		Key:                  aws.String(key),
 		Body:                 bytes.NewReader(fileBuffer),
@@ -39,25 +48,102 @@ func Upload(bucket string, source string, key string) error {
 		ContentType:          aws.String(http.DetectContentType(fileBuffer)),
 		ContentDisposition:   aws.String("attachment"),
 		ServerSideEncryption: aws.String("AES256"),
+	}
+
+	return resilience.Call(ctx, resilience.S3, func(ctx context.Context) error {
+		// Body is a reader; rewind it so retries upload the whole object
+		input.Body.Seek(0, io.SeekStart)
+		_, err := svc.PutObjectWithContext(ctx, input)
+		return err
 	})
-	return err
 
 }
 
 func Save(buffer []byte, bucket string, key string) error {
+	return SaveWithContext(context.Background(), buffer, bucket, key)
+}
+
+func SaveWithContext(ctx context.Context, buffer []byte, bucket string, key string) error {
 	session, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
 	if err != nil {
 		log.Fatal(err)
 		return err
 	}
 
-	_, err = s3.New(session).PutObject(&s3.PutObjectInput{
+	svc := s3.New(session)
+	input := &s3.PutObjectInput{
 		Bucket:               aws.String(bucket),
 		Key:                  aws.String(key),
 		Body:                 bytes.NewReader(buffer),
 		ContentType:          aws.String(http.DetectContentType(buffer)),
 		ContentDisposition:   aws.String("attachment"),
 		ServerSideEncryption: aws.String("AES256"),
+	}
+
+	return resilience.Call(ctx, resilience.S3, func(ctx context.Context) error {
+		// Body is a reader; rewind it so retries upload the whole object
+		input.Body.Seek(0, io.SeekStart)
+		_, err := svc.PutObjectWithContext(ctx, input)
+		return err
+	})
+}
+
+func GetWithContext(ctx context.Context, bucket string, key string) ([]byte, error) {
+	session, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
+	if err != nil {
+		return nil, err
+	}
+
+	svc := s3.New(session)
+
+	var body []byte
+	err = resilience.Call(ctx, resilience.S3, func(ctx context.Context) error {
+		output, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+		defer output.Body.Close()
+
+		body, err = io.ReadAll(output.Body)
+		return err
 	})
-	return err
+	return body, err
+}
+
+func ListWithContext(ctx context.Context, bucket string, prefix string) ([]string, error) {
+	session, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
+	if err != nil {
+		return nil, err
+	}
+
+	svc := s3.New(session)
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	var keys []string
+	for {
+		var output *s3.ListObjectsV2Output
+		err := resilience.Call(ctx, resilience.S3, func(ctx context.Context) error {
+			var err error
+			output, err = svc.ListObjectsV2WithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range output.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			return keys, nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
 }
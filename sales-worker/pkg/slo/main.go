@@ -0,0 +1,265 @@
+package slo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"sales-worker/pkg/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config - Latency objective of the pipeline and the burn rates that page. A sale is good
+// when it is processed within Threshold of its creation; Objective is the good fraction
+type Config struct {
+	Objective    float64
+	Threshold    time.Duration
+	FastBurnRate float64
+	SlowBurnRate float64
+}
+
+// DefaultConfig - 99% of the sales within a minute; 14.4 and 6 are the multiwindow burn
+// rates that spend 2% and 5% of a 30 day error budget in 1 and 6 hours
+var DefaultConfig = Config{
+	Objective:    0.99,
+	Threshold:    time.Minute,
+	FastBurnRate: 14.4,
+	SlowBurnRate: 6,
+}
+
+// Burn rate windows; each alert needs the long and the short window over the rate
+var windows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+}
+
+// buckets - One per minute of the longest window
+const buckets = 6 * 60
+
+type bucket struct {
+	minute int64
+	good   int64
+	total  int64
+}
+
+// Status - Result of an evaluation
+type Status struct {
+	Objective         float64            `json:"objective"`
+	ThresholdSeconds  float64            `json:"threshold_seconds"`
+	BurnRates         map[string]float64 `json:"burn_rates"`
+	BacklogAgeSeconds float64            `json:"backlog_age_seconds"`
+	Breaching         bool               `json:"breaching"`
+	Reason            string             `json:"reason,omitempty"`
+}
+
+var (
+	burnRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sales_slo_burn_rate",
+		Help: "Error budget burn rate of the end-to-end latency objective by window",
+	}, []string{"window"})
+
+	breaching = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sales_slo_breaching",
+		Help: "1 when the end-to-end latency objective is burning its error budget too fast",
+	})
+
+	backlogAge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sales_queue_oldest_message_age_seconds",
+		Help: "ApproximateAgeOfOldestMessage of the sales queue at the last SLO evaluation",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(burnRate, breaching, backlogAge)
+}
+
+// BacklogSource - Reads the age of the oldest message waiting in the queue
+type BacklogSource func(ctx context.Context) (time.Duration, error)
+
+// clock - Replaced by tests to place samples in past minutes
+var clock = time.Now
+
+var (
+	mutex   sync.Mutex
+	config  = DefaultConfig
+	history [buckets]bucket
+	oldest  time.Duration
+	last    Status
+)
+
+// Setup - Replaces the objective; zero fields keep their defaults
+func Setup(c Config) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if c.Objective <= 0 || c.Objective >= 1 {
+		c.Objective = DefaultConfig.Objective
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultConfig.Threshold
+	}
+	if c.FastBurnRate <= 0 {
+		c.FastBurnRate = DefaultConfig.FastBurnRate
+	}
+	if c.SlowBurnRate <= 0 {
+		c.SlowBurnRate = DefaultConfig.SlowBurnRate
+	}
+	config = c
+}
+
+// Record - Counts a processed sale against the objective by its end-to-end latency
+func Record(latency time.Duration) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	current := currentBucket()
+	current.total++
+	if latency <= config.Threshold {
+		current.good++
+	}
+}
+
+// RecordFailure - Counts a failed processing attempt as a bad event; retried sales count
+// once per failed attempt and once more when they are finally processed
+func RecordFailure() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	currentBucket().total++
+}
+
+// currentBucket - Bucket of the current minute, reset when it last held an older minute
+func currentBucket() *bucket {
+	minute := clock().Unix() / 60
+	current := &history[minute%buckets]
+	if current.minute != minute {
+		*current = bucket{minute: minute}
+	}
+	return current
+}
+
+// SetBacklogAge - Age of the oldest message waiting in the queue. Stalled consumers record
+// no latencies at all, so a backlog older than the threshold also breaches the objective
+func SetBacklogAge(age time.Duration) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	oldest = age
+	backlogAge.Set(age.Seconds())
+}
+
+// Evaluate - Burn rates of every window, the multiwindow alert and the backlog age
+func Evaluate() Status {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	now := clock().Unix() / 60
+	status := Status{
+		Objective:         config.Objective,
+		ThresholdSeconds:  config.Threshold.Seconds(),
+		BurnRates:         make(map[string]float64, len(windows)),
+		BacklogAgeSeconds: oldest.Seconds(),
+	}
+
+	for _, window := range windows {
+		var good, total int64
+		since := now - int64(window.duration/time.Minute)
+		for _, b := range history {
+			if b.minute > since && b.minute <= now {
+				good += b.good
+				total += b.total
+			}
+		}
+
+		rate := 0.0
+		if total > 0 {
+			rate = (float64(total-good) / float64(total)) / (1 - config.Objective)
+		}
+		status.BurnRates[window.name] = rate
+		burnRate.WithLabelValues(window.name).Set(rate)
+	}
+
+	switch {
+	case status.BurnRates["1h"] > config.FastBurnRate && status.BurnRates["5m"] > config.FastBurnRate:
+		status.Breaching = true
+		status.Reason = "fast burn"
+	case status.BurnRates["6h"] > config.SlowBurnRate && status.BurnRates["30m"] > config.SlowBurnRate:
+		status.Breaching = true
+		status.Reason = "slow burn"
+	case oldest > config.Threshold:
+		status.Breaching = true
+		status.Reason = "backlog age"
+	}
+
+	if status.Breaching {
+		breaching.Set(1)
+	} else {
+		breaching.Set(0)
+	}
+
+	last = status
+	return status
+}
+
+// Last - Status of the last evaluation
+func Last() Status {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return last
+}
+
+// Run - Reads the backlog age from backlog and evaluates the objective every interval until
+// stop is cancelled; logs when the pipeline starts and stops breaching
+func Run(stop context.Context, interval time.Duration, backlog BacklogSource) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	was_breaching := false
+	for {
+		if backlog != nil {
+			age, err := backlog(stop)
+			if err != nil && stop.Err() == nil {
+				logger := log.Instance()
+				logger.Warn().
+					Str("Action", "slo").
+					Str("Error", err.Error()).
+					Msg("Error to read the backlog age; keeping the last one")
+			}
+			if err == nil {
+				SetBacklogAge(age)
+			}
+		}
+
+		status := Evaluate()
+
+		if status.Breaching != was_breaching {
+			logger := log.Instance()
+			if status.Breaching {
+				logger.Warn().
+					Str("Action", "slo").
+					Str("Reason", status.Reason).
+					Interface("BurnRates", status.BurnRates).
+					Float64("BacklogAge", status.BacklogAgeSeconds).
+					Msg("End-to-end latency objective breached")
+			} else {
+				logger.Info().
+					Str("Action", "slo").
+					Interface("BurnRates", status.BurnRates).
+					Msg("End-to-end latency objective recovered")
+			}
+			was_breaching = status.Breaching
+		}
+
+		select {
+		case <-stop.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
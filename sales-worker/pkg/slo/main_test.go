@@ -0,0 +1,169 @@
+package slo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// at - Points the clock at minutes before the evaluation time
+func at(now time.Time, minutes_ago int) {
+	clock = func() time.Time { return now.Add(-time.Duration(minutes_ago) * time.Minute) }
+}
+
+// reset - Empties the history and returns the evaluation time of the test
+func reset(t *testing.T) time.Time {
+	now := time.Date(2026, 10, 19, 12, 0, 30, 0, time.UTC)
+	history = [buckets]bucket{}
+	oldest = 0
+	Setup(DefaultConfig)
+	t.Cleanup(func() {
+		clock = time.Now
+		history = [buckets]bucket{}
+		oldest = 0
+	})
+	return now
+}
+
+// fill - Records total samples per minute, bad of them over the threshold, for each minute ago in from..to
+func fill(now time.Time, from int, to int, total int, bad int) {
+	for minute := from; minute <= to; minute++ {
+		at(now, minute)
+		for i := 0; i < total; i++ {
+			latency := time.Second
+			if i < bad {
+				latency = 2 * time.Minute
+			}
+			Record(latency)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+
+	tests := map[string]struct {
+		setup     func(t *testing.T, now time.Time)
+		breaching bool
+		reason    string
+		rates     map[string]float64
+	}{
+		"No Samples": {
+			setup:     func(t *testing.T, now time.Time) {},
+			breaching: false,
+			rates:     map[string]float64{"5m": 0, "30m": 0, "1h": 0, "6h": 0},
+		},
+		"Within Objective": {
+			setup:     func(t *testing.T, now time.Time) { fill(now, 0, 359, 100, 1) },
+			breaching: false,
+			rates:     map[string]float64{"5m": 1, "30m": 1, "1h": 1, "6h": 1},
+		},
+		"Fast Burn": {
+			// 20% bad over the last hour burns 20 times the budget in every window
+			setup:     func(t *testing.T, now time.Time) { fill(now, 0, 59, 100, 20) },
+			breaching: true,
+			reason:    "fast burn",
+			rates:     map[string]float64{"5m": 20, "30m": 20, "1h": 20, "6h": 20},
+		},
+		"Fast Burn Stopped": {
+			// The 5m window clears the fast burn as soon as the errors stop; the 30m and
+			// 6h windows still hold the slow burn
+			setup: func(t *testing.T, now time.Time) {
+				fill(now, 5, 59, 100, 20)
+				fill(now, 0, 4, 100, 0)
+			},
+			breaching: true,
+			reason:    "slow burn",
+			rates:     map[string]float64{"5m": 0, "1h": 55.0 / 60 * 20},
+		},
+		"Slow Burn": {
+			setup:     func(t *testing.T, now time.Time) { fill(now, 0, 359, 100, 8) },
+			breaching: true,
+			reason:    "slow burn",
+			rates:     map[string]float64{"5m": 8, "30m": 8, "1h": 8, "6h": 8},
+		},
+		"Older Than Six Hours Ignored": {
+			setup:     func(t *testing.T, now time.Time) { fill(now, 360, 400, 100, 100) },
+			breaching: false,
+			rates:     map[string]float64{"6h": 0},
+		},
+		"Failures Are Bad Events": {
+			setup: func(t *testing.T, now time.Time) {
+				fill(now, 0, 59, 80, 0)
+				for minute := 0; minute <= 59; minute++ {
+					at(now, minute)
+					for i := 0; i < 20; i++ {
+						RecordFailure()
+					}
+				}
+			},
+			breaching: true,
+			reason:    "fast burn",
+			rates:     map[string]float64{"5m": 20, "1h": 20},
+		},
+		"Backlog Age": {
+			setup:     func(t *testing.T, now time.Time) { SetBacklogAge(2 * time.Minute) },
+			breaching: true,
+			reason:    "backlog age",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := reset(t)
+			test.setup(t, now)
+
+			clock = func() time.Time { return now }
+			status := Evaluate()
+
+			if status.Breaching != test.breaching || status.Reason != test.reason {
+				t.Errorf("got breaching %v (%q) want %v (%q)", status.Breaching, status.Reason, test.breaching, test.reason)
+			}
+			for window, want := range test.rates {
+				if got := status.BurnRates[window]; got < want-0.001 || got > want+0.001 {
+					t.Errorf("got %s burn rate %.3f want %.3f", window, got, want)
+				}
+			}
+		})
+	}
+
+}
+
+func TestRun(t *testing.T) {
+
+	t.Run("Backlog Read Without Autoscaler", func(t *testing.T) {
+		reset(t)
+
+		stop, cancel := context.WithCancel(context.Background())
+		cancel()
+		Run(stop, time.Hour, func(context.Context) (time.Duration, error) {
+			return 10 * time.Minute, nil
+		})
+
+		if status := Last(); !status.Breaching || status.Reason != "backlog age" {
+			t.Errorf("got %+v want backlog age breach", status)
+		}
+	})
+
+	t.Run("Backlog Kept On Error", func(t *testing.T) {
+		reset(t)
+		SetBacklogAge(3 * time.Minute)
+
+		stop, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			Run(stop, time.Hour, func(context.Context) (time.Duration, error) {
+				defer cancel()
+				return 0, errors.New("throttled")
+			})
+		}()
+		<-done
+
+		if status := Last(); status.BacklogAgeSeconds != 180 {
+			t.Errorf("got backlog age %.0fs want 180s", status.BacklogAgeSeconds)
+		}
+	})
+
+}
@@ -0,0 +1,173 @@
+package sns
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// NotificationType - Type of the SNS messages delivered to subscriptions without raw delivery
+const NotificationType = "Notification"
+
+var (
+	ErrInvalidSignature = errors.New("invalid sns signature")
+	ErrUnknownSigner    = errors.New("sns message signed by an unexpected certificate")
+)
+
+// Notification - SNS envelope wrapping the published message when raw message delivery is disabled
+type Notification struct {
+	Type              string
+	MessageId         string
+	TopicArn          string
+	Subject           string
+	Message           string
+	Timestamp         string
+	SignatureVersion  string
+	Signature         string
+	SigningCertURL    string
+	MessageAttributes map[string]Attribute
+}
+
+type Attribute struct {
+	Type  string
+	Value string
+}
+
+var (
+	mutex       sync.RWMutex
+	certificate *x509.Certificate
+)
+
+// Setup - Enables signature verification with the PEM certificate at path; an empty path disables it
+func Setup(path string) error {
+	var loaded *x509.Certificate
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		block, _ := pem.Decode(content)
+		if block == nil {
+			return fmt.Errorf("no PEM certificate found in %s", path)
+		}
+
+		loaded, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	certificate = loaded
+	return nil
+}
+
+// Unwrap - Returns the notification when body is an SNS envelope; raw deliveries return false
+func Unwrap(body string) (*Notification, bool) {
+	// Exact key match: encoding/json is case insensitive and sale events carry a "type" field
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return nil, false
+	}
+
+	var kind string
+	if err := json.Unmarshal(fields["Type"], &kind); err != nil || kind != NotificationType {
+		return nil, false
+	}
+	if _, found := fields["TopicArn"]; !found {
+		return nil, false
+	}
+	if _, found := fields["Message"]; !found {
+		return nil, false
+	}
+
+	var notification Notification
+	if err := json.Unmarshal([]byte(body), &notification); err != nil {
+		return nil, false
+	}
+
+	return &notification, true
+}
+
+// Attributes - String and Number message attributes; Binary attributes are skipped
+func (n *Notification) Attributes() map[string]string {
+	attributes := make(map[string]string, len(n.MessageAttributes))
+	for name, attribute := range n.MessageAttributes {
+		if strings.HasPrefix(attribute.Type, "Binary") {
+			continue
+		}
+		attributes[name] = attribute.Value
+	}
+	return attributes
+}
+
+// Verify - Checks the notification signature when verification is enabled
+func (n *Notification) Verify() error {
+	mutex.RLock()
+	signer := certificate
+	mutex.RUnlock()
+
+	if signer == nil {
+		return nil
+	}
+
+	public_key, ok := signer.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return ErrUnknownSigner
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(n.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	switch n.SignatureVersion {
+	case "1":
+		sum := sha1.Sum([]byte(n.stringToSign()))
+		hash, digest = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256([]byte(n.stringToSign()))
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return fmt.Errorf("%w: unsupported signature version %q", ErrInvalidSignature, n.SignatureVersion)
+	}
+
+	if err := rsa.VerifyPKCS1v15(public_key, hash, digest, signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// stringToSign - Canonical notification fields, in the order SNS signs them
+func (n *Notification) stringToSign() string {
+	var builder strings.Builder
+	write := func(name string, value string) {
+		builder.WriteString(name + "\n" + value + "\n")
+	}
+
+	write("Message", n.Message)
+	write("MessageId", n.MessageId)
+	if n.Subject != "" {
+		write("Subject", n.Subject)
+	}
+	write("Timestamp", n.Timestamp)
+	write("TopicArn", n.TopicArn)
+	write("Type", n.Type)
+
+	return builder.String()
+}
@@ -0,0 +1,181 @@
+package sns
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnwrap(t *testing.T) {
+
+	tests := map[string]struct {
+		body    string
+		wrapped bool
+	}{
+		"Notification":           {`{"Type":"Notification","TopicArn":"arn:aws:sns:us-east-1:0:sales","Message":"{}"}`, true},
+		"Raw Sale Event":         {`{"type":"sale.created","id":"1","data":{}}`, false},
+		"Lowercase Envelope":     {`{"type":"Notification","topicarn":"arn","message":"{}"}`, false},
+		"Subscription Confirm":   {`{"Type":"SubscriptionConfirmation","TopicArn":"arn","Message":"confirm"}`, false},
+		"Missing Topic":          {`{"Type":"Notification","Message":"{}"}`, false},
+		"Missing Message":        {`{"Type":"Notification","TopicArn":"arn"}`, false},
+		"Not JSON":               {`sale`, false},
+		"Type With Wrong Format": {`{"Type":1,"TopicArn":"arn","Message":"{}"}`, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			notification, wrapped := Unwrap(test.body)
+			if wrapped != test.wrapped {
+				t.Fatalf("got wrapped %v want %v", wrapped, test.wrapped)
+			}
+			if wrapped && notification.Message != "{}" {
+				t.Errorf("got message %q", notification.Message)
+			}
+		})
+	}
+
+	t.Run("String Attributes Only", func(t *testing.T) {
+		notification, _ := Unwrap(`{"Type":"Notification","TopicArn":"arn","Message":"{}","MessageAttributes":{"content-type":{"Type":"String","Value":"application/json"},"raw":{"Type":"Binary","Value":"AA=="}}}`)
+		attributes := notification.Attributes()
+		if len(attributes) != 1 || attributes["content-type"] != "application/json" {
+			t.Errorf("got attributes %v", attributes)
+		}
+	})
+
+}
+
+func TestVerify(t *testing.T) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeCertificate(t, key)
+
+	sign := func(n *Notification) {
+		var signature []byte
+		switch n.SignatureVersion {
+		case "1":
+			sum := sha1.Sum([]byte(n.stringToSign()))
+			signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum[:])
+		default:
+			sum := sha256.Sum256([]byte(n.stringToSign()))
+			signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		}
+		n.Signature = base64.StdEncoding.EncodeToString(signature)
+	}
+
+	notification := func(version string) *Notification {
+		return &Notification{
+			Type:             NotificationType,
+			MessageId:        "b8a2f0e4",
+			TopicArn:         "arn:aws:sns:us-east-1:0:sales",
+			Message:          `{"type":"sale.created"}`,
+			Timestamp:        "2026-10-19T12:00:00.000Z",
+			SignatureVersion: version,
+		}
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		if err := Setup(""); err != nil {
+			t.Fatal(err)
+		}
+		if err := notification("2").Verify(); err != nil {
+			t.Errorf("got %v want nil", err)
+		}
+	})
+
+	if err := Setup(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Setup("") })
+
+	tests := map[string]struct {
+		version string
+		tamper  func(n *Notification)
+		want    error
+	}{
+		"Signature Version 1":  {"1", nil, nil},
+		"Signature Version 2":  {"2", nil, nil},
+		"With Subject":         {"2", func(n *Notification) { n.Subject = "sale"; sign(n) }, nil},
+		"Tampered Message":     {"2", func(n *Notification) { n.Message = `{"type":"sale.deleted"}` }, ErrInvalidSignature},
+		"Subject Added":        {"2", func(n *Notification) { n.Subject = "sale" }, ErrInvalidSignature},
+		"Signature Not Base64": {"2", func(n *Notification) { n.Signature = "%%" }, ErrInvalidSignature},
+		"Unknown Version":      {"3", nil, ErrInvalidSignature},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			n := notification(test.version)
+			sign(n)
+			if test.tamper != nil {
+				test.tamper(n)
+			}
+			if err := n.Verify(); !errors.Is(err, test.want) {
+				t.Errorf("got %v want %v", err, test.want)
+			}
+		})
+	}
+
+	t.Run("Signed By Another Key", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := notification("2")
+		sum := sha256.Sum256([]byte(n.stringToSign()))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, other, crypto.SHA256, sum[:])
+		n.Signature = base64.StdEncoding.EncodeToString(signature)
+		if err := n.Verify(); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("got %v want %v", err, ErrInvalidSignature)
+		}
+	})
+
+}
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() { Setup("") })
+
+	if err := Setup(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("expected error for a missing certificate")
+	}
+
+	path := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(path, []byte("not a certificate"), 0o600)
+	if err := Setup(path); err == nil {
+		t.Error("expected error for a file without PEM block")
+	}
+}
+
+// writeCertificate - Self-signed certificate of key, written as PEM to a temporary file
+func writeCertificate(t *testing.T, key *rsa.PrivateKey) string {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.us-east-1.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sns.pem")
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,163 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"sales-worker/pkg/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	restartBaseDelay = time.Second
+	restartMaxDelay  = time.Minute
+
+	// stableAfter - A consumer running this long without panicking resets its restart backoff
+	stableAfter = time.Minute
+)
+
+type threadKey struct{}
+
+var (
+	mutex      sync.Mutex
+	heartbeats = make(map[int]time.Time)
+
+	restarts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sales_worker_consumer_restarts_total",
+		Help: "Consumer goroutines restarted by the supervisor after a panic",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(restarts)
+}
+
+// Supervise - Runs the consumer and restarts it with backoff when it panics; returns when the
+// consumer returns on its own or stop is cancelled
+func Supervise(consume func(stop context.Context, thread int)) func(stop context.Context, thread int) {
+	return func(stop context.Context, thread int) {
+		delay := restartBaseDelay
+
+		Register(thread)
+		defer Unregister(thread)
+
+		for {
+			started := time.Now()
+			recovered := run(consume, stop, thread)
+			if recovered == nil || stop.Err() != nil {
+				return
+			}
+
+			if time.Since(started) > stableAfter {
+				delay = restartBaseDelay
+			}
+
+			restarts.Inc()
+			logger := log.Instance()
+			logger.Error().
+				Str("Action", "supervisor").
+				Int("Thread", thread).
+				Str("Panic", fmt.Sprint(recovered)).
+				Dur("Backoff", delay).
+				Msg("Consumer thread panicked; restarting")
+
+			select {
+			case <-stop.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			delay *= 2
+			if delay > restartMaxDelay {
+				delay = restartMaxDelay
+			}
+		}
+	}
+}
+
+// run - Calls the consumer and returns the panic value, nil when it returned normally
+func run(consume func(stop context.Context, thread int), stop context.Context, thread int) (recovered interface{}) {
+	defer func() {
+		if recovered = recover(); recovered != nil {
+			logger := log.Instance()
+			logger.Error().
+				Str("Action", "supervisor").
+				Int("Thread", thread).
+				Str("Stack", string(debug.Stack())).
+				Msg("Consumer thread stack")
+		}
+	}()
+
+	consume(stop, thread)
+	return nil
+}
+
+// Register - Starts tracking the heartbeat of the thread
+func Register(thread int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	heartbeats[thread] = time.Now()
+}
+
+// Unregister - Stops tracking a thread that left, e.g. on scale down
+func Unregister(thread int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	delete(heartbeats, thread)
+}
+
+// WithThread - Context of a consumer thread; Beat records progress for it
+func WithThread(ctx context.Context, thread int) context.Context {
+	return context.WithValue(ctx, threadKey{}, thread)
+}
+
+// Beat - Records progress of the thread of the context; no-op outside a consumer thread
+func Beat(ctx context.Context) {
+	thread, found := ctx.Value(threadKey{}).(int)
+	if !found {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, registered := heartbeats[thread]; registered {
+		heartbeats[thread] = time.Now()
+	}
+}
+
+// Heartbeats - Last progress of every tracked thread
+func Heartbeats() map[int]time.Time {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	snapshot := make(map[int]time.Time, len(heartbeats))
+	for thread, beat := range heartbeats {
+		snapshot[thread] = beat
+	}
+	return snapshot
+}
+
+// Alive - False when threads are tracked and none of them made progress within window;
+// returns the age of the most recent heartbeat
+func Alive(window time.Duration) (bool, time.Duration) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(heartbeats) == 0 {
+		return true, 0
+	}
+
+	var latest time.Time
+	for _, beat := range heartbeats {
+		if beat.After(latest) {
+			latest = beat
+		}
+	}
+
+	age := time.Since(latest)
+	return age <= window, age
+}
@@ -0,0 +1,87 @@
+package supervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSupervise(t *testing.T) {
+
+	t.Run("Restarts After Panic", func(t *testing.T) {
+		runs := 0
+		consume := Supervise(func(stop context.Context, thread int) {
+			runs++
+			if runs == 1 {
+				panic("boom")
+			}
+		})
+
+		started := time.Now()
+		consume(context.Background(), 100)
+
+		if runs != 2 {
+			t.Errorf("got %d runs want 2", runs)
+		}
+		if elapsed := time.Since(started); elapsed < restartBaseDelay {
+			t.Errorf("restarted after %s, before the backoff of %s", elapsed, restartBaseDelay)
+		}
+		if _, tracked := Heartbeats()[100]; tracked {
+			t.Error("thread still tracked after the consumer returned")
+		}
+	})
+
+	t.Run("Stop During Backoff", func(t *testing.T) {
+		stop, cancel := context.WithCancel(context.Background())
+		runs := 0
+		consume := Supervise(func(stop context.Context, thread int) {
+			runs++
+			cancel()
+			panic("boom")
+		})
+
+		consume(stop, 101)
+
+		if runs != 1 {
+			t.Errorf("got %d runs want 1", runs)
+		}
+	})
+
+}
+
+func TestHeartbeats(t *testing.T) {
+
+	Register(200)
+	Register(201)
+	defer Unregister(200)
+
+	if alive, _ := Alive(time.Minute); !alive {
+		t.Error("fresh threads not alive")
+	}
+
+	mutex.Lock()
+	heartbeats[200] = time.Now().Add(-time.Hour)
+	heartbeats[201] = time.Now().Add(-time.Hour)
+	mutex.Unlock()
+
+	if alive, _ := Alive(time.Minute); alive {
+		t.Error("stalled threads reported alive")
+	}
+
+	Beat(context.Background())
+	if alive, _ := Alive(time.Minute); alive {
+		t.Error("beat outside a consumer thread counted as progress")
+	}
+
+	Beat(WithThread(context.Background(), 200))
+	if alive, _ := Alive(time.Minute); !alive {
+		t.Error("beat of a consumer thread not counted as progress")
+	}
+
+	Unregister(201)
+	Beat(WithThread(context.Background(), 201))
+	if _, tracked := Heartbeats()[201]; tracked {
+		t.Error("beat registered an unregistered thread again")
+	}
+
+}